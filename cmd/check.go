@@ -0,0 +1,30 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var checkCmd = &cobra.Command{
+	Use:   "check [path...]",
+	Short: "Report outdated modules, providers and Terraform versions without changing any file.",
+	Long: `Resolve the latest versions like tfau does, but never write any file.
+The exit code is 0 when everything is up to date, 2 when something is out of date,
+3 when a version lookup failed and 4 when a file could not be parsed.`,
+	Args:        cobra.ArbitraryArgs,
+	Annotations: map[string]string{pathArgs: "true"},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Failures past this point are not usage errors
+		cmd.SilenceUsage = true
+
+		// Resolve every file without writing anything
+		result, results := processFiles(false, false)
+		if err := writeReport(results); err != nil {
+			return err
+		}
+		return result.err(true)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(checkCmd)
+}
@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"tfau/lib/config"
+	"tfau/lib/registry"
+	"tfau/lib/semver"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	configFile string       // Configuration file given on the command line
+	rules      config.Rules // Per-dependency rules of the configuration file
+)
+
+// applyConfig loads the --config file, or the .tfau.hcl of the working directory or of
+// its closest parent, and uses its settings for the flags not given on the command line.
+// Lists that add up (exclude, prerelease_for, tag_patterns) are combined with the flags.
+func applyConfig(cmd *cobra.Command) error {
+	file := configFile
+	if file == "" {
+		cwd, err := os.Getwd()
+		if err != nil {
+			return fmt.Errorf("failed to get current working directory: %v", err)
+		}
+		if file, err = config.Find(cwd); err != nil || file == "" {
+			return err
+		}
+	}
+	log.Printf("Using configuration file %s", file)
+
+	cfg, err := config.Load(file)
+	if err != nil {
+		return err
+	}
+	flags := cmd.Flags()
+
+	// Defaults of the flags
+	if cfg.Upgrades != nil && !flags.Changed("upgrades") {
+		upgrades = strings.Join(cfg.Upgrades, ",")
+	}
+	if cfg.MaxBump != nil && !flags.Changed("max-bump") {
+		maxBump = *cfg.MaxBump
+	}
+	if cfg.AllowPrerelease != nil && !flags.Changed("allow-prerelease") {
+		allowPrerelease = *cfg.AllowPrerelease
+	}
+	if cfg.Tofu != nil && !flags.Changed("tofu") {
+		tofu = *cfg.Tofu
+	}
+	if cfg.Include != nil && !flags.Changed("include") {
+		include = cfg.Paths(cfg.Include)
+	}
+	if cfg.GitIgnore != nil && !flags.Changed("gitignore") {
+		gitIgnore = *cfg.GitIgnore
+	}
+	if cfg.Lock != nil && !flags.Changed("lock") {
+		updateLock = *cfg.Lock
+	}
+	if cfg.LockPlatforms != nil && !flags.Changed("lock-platform") {
+		lockPlatforms = cfg.LockPlatforms
+	}
+	if cfg.ExpandProviders != nil && !flags.Changed("expand-providers") {
+		expandProviders = *cfg.ExpandProviders
+	}
+
+	// Lists combined with the flags, the flags coming last so that they win
+	exclude = append(cfg.Paths(cfg.Exclude), exclude...)
+	prereleaseFor = append(cfg.PrereleaseFor, prereleaseFor...)
+	var patterns []string
+	for _, source := range sortedKeys(cfg.TagPatterns) {
+		patterns = append(patterns, source+"="+cfg.TagPatterns[source])
+	}
+	tagPatternFlags = append(patterns, tagPatternFlags...)
+
+	// Registries served without service discovery
+	for _, r := range cfg.Registries {
+		registry.SetServices(r.Host, r.Services)
+	}
+
+	// Per-dependency rules
+	rules, err = cfg.Rules()
+	return err
+}
+
+// ignored reports whether a rule of the configuration file excludes a dependency,
+// logging it when it does.
+func ignored(address string, file string) bool {
+	if !rules.Ignores(address) {
+		return false
+	}
+	log.Printf("Skipping %s in file %s: ignored by the configuration file\n", address, file)
+	return true
+}
+
+// policyFor returns the version policy of a dependency: the policy of the flags with
+// the rules of the configuration file that match its address.
+func policyFor(address string) semver.Policy {
+	return rules.Policy(policy.For(address), address)
+}
+
+func init() {
+	// Config flag (optional)
+	rootCmd.PersistentFlags().StringVar(&configFile, "config", "", "Configuration file (default: "+config.Filename+" in the working directory or its closest parent)")
+}
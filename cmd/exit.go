@@ -0,0 +1,25 @@
+package cmd
+
+// Exit codes returned by tfau, so that CI can tell an outdated project from a
+// failed lookup or an unparseable file.
+const (
+	ExitOutdated        = 2 // At least one dependency is out of date (check mode only)
+	ExitResolutionError = 3 // At least one version lookup failed
+	ExitParseError      = 4 // At least one file could not be parsed or rewritten
+)
+
+// ExitError is an error that requests a specific process exit code.
+type ExitError struct {
+	Code int
+	Err  error
+}
+
+// Error returns the message of the wrapped error.
+func (e *ExitError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the wrapped error.
+func (e *ExitError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"tfau/lib/registry"
+	"tfau/lib/report"
+	"tfau/lib/terraform"
+
+	"github.com/spf13/cobra"
+)
+
+var indexCmd = &cobra.Command{
+	Use:   "index",
+	Short: "Manage version index files used by --offline.",
+}
+
+var indexExportCmd = &cobra.Command{
+	Use:   "export [file]",
+	Short: "Write the versions available for every dependency to an index file.",
+	Long: `Resolve every module, provider and Terraform version used by the files and
+write all their available versions to a JSON index (stdout when no file is given).
+Ship the index to an air-gapped host and run tfau there with --offline --index <file>.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Failures past this point are not usage errors
+		cmd.SilenceUsage = true
+
+		// Collect and resolve every dependency
+		var result summary
+		versions := newResolver()
+		loadFiles(versions, &report.Report{}, &result)
+		versions.Resolve()
+
+		// Every dependency must be resolved for the index to be usable offline
+		idx, err := versions.Export()
+		if err != nil {
+			return &ExitError{Code: ExitResolutionError, Err: err}
+		}
+
+		// Record what hostless addresses and the Terraform versions refer to
+		idx.Distribution = string(terraform.Target)
+		idx.Registry = registry.DefaultHost
+
+		data, err := idx.Marshal()
+		if err != nil {
+			return err
+		}
+		if len(args) == 0 {
+			if _, err := os.Stdout.Write(data); err != nil {
+				return err
+			}
+		} else if err := os.WriteFile(args[0], data, 0644); err != nil {
+			return fmt.Errorf("failed to write index file: %v", err)
+		}
+		return result.err(false)
+	},
+}
+
+func init() {
+	indexCmd.AddCommand(indexExportCmd)
+	rootCmd.AddCommand(indexCmd)
+}
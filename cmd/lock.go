@@ -0,0 +1,474 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"tfau/lib/constraint"
+	"tfau/lib/hcl"
+	"tfau/lib/lockfile"
+	"tfau/lib/module"
+	"tfau/lib/provider"
+	"tfau/lib/report"
+	"tfau/lib/resolver"
+
+	"github.com/hashicorp/go-version"
+	hcl2 "github.com/hashicorp/hcl/v2"
+	"github.com/spf13/cobra"
+)
+
+var lockCmd = &cobra.Command{
+	Use:   "lock",
+	Short: "Manage the .terraform.lock.hcl files of root modules.",
+}
+
+var lockVerifyCmd = &cobra.Command{
+	Use:   "verify [path...]",
+	Short: "Report the lock files that disagree with the provider constraints of their root module.",
+	Long: `Compare the .terraform.lock.hcl of every root module with the required_providers of
+the module and of the child modules it calls. Locked versions outside a constraint,
+required providers missing from the lock file, locked providers no longer used and
+locked versions without a hash for a --lock-platform are reported.
+The exit code is 0 when every lock file is consistent, 2 when one is not, 3 when a
+package lookup failed and 4 when a file could not be parsed.`,
+	Args:        cobra.ArbitraryArgs,
+	Annotations: map[string]string{pathArgs: "true"},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Failures past this point are not usage errors
+		cmd.SilenceUsage = true
+
+		// Verify every lock file without writing anything
+		result, results := verifyLockFiles()
+		if err := writeReport(results); err != nil {
+			return err
+		}
+		return result.err(true)
+	},
+}
+
+// lockedHashes is the outcome of hashing the packages of a provider version.
+type lockedHashes struct {
+	hashes []string
+	err    error
+}
+
+// updateLockFiles locks the provider versions resolved for the files of each root
+// module in the .terraform.lock.hcl of the module, if it has one: the version, the
+// constraints of the module tree and the package hashes of the entry of each provider
+// are rewritten. The versions resolved for the local child modules a root module calls
+// are locked with it, at the newest version that satisfies the constraints of every
+// file of the tree as they are written. Providers without an entry are left to
+// terraform init. The hashes are only fetched when the lock file is written or diffed,
+// which needs the network: with --offline, lock files are then left alone.
+//
+// Nothing is saved: it returns the lock files found, edited in memory, and the
+// directories of the modules that must not be saved because the lock file of a root
+// module calling them could not be updated.
+func updateLockFiles(plans []*filePlan, versions *resolver.Resolver, write bool, showDiff bool, results *report.Report, result *summary) ([]*hcl.Document, map[string]bool) {
+	if !providers || !updateLock {
+		return nil, nil
+	}
+	if offline && (write || showDiff) {
+		log.Println("Not updating lock files with --offline: the package hashes of new provider versions are downloaded. Run terraform init -upgrade after the upgrade.")
+		return nil, nil
+	}
+
+	// Collect the newest version and the constraints of each provider source per module
+	latestByDir := make(map[string]map[string]string)
+	constraintsByDir := make(map[string]map[string][]string)
+	for _, plan := range plans {
+		dir := filepath.Dir(plan.doc.Filename)
+		for _, requirement := range plan.providers {
+			if requirement.Version == "" {
+				continue
+			}
+			written := requirement.Version
+			if latestVersion, ok := plan.latestProviders[requirement.Source]; ok {
+				if rewritten, err := constraint.Rewrite(requirement.Version, latestVersion); err == nil {
+					written = rewritten
+				}
+			}
+			if constraintsByDir[dir] == nil {
+				constraintsByDir[dir] = make(map[string][]string)
+			}
+			constraintsByDir[dir][requirement.Source] = append(constraintsByDir[dir][requirement.Source], written)
+		}
+		for source, latestVersion := range plan.latestProviders {
+			if latestByDir[dir] == nil {
+				latestByDir[dir] = make(map[string]string)
+			}
+			if current, exists := latestByDir[dir][source]; !exists || newer(latestVersion, current) {
+				latestByDir[dir][source] = latestVersion
+			}
+		}
+	}
+
+	// A root module locks the providers of its whole tree of local modules
+	latestByRoot := make(map[string]map[string]string)
+	constraintsByRoot := make(map[string]map[string][]string)
+	for _, root := range proj.Roots() {
+		for _, m := range proj.Tree(root) {
+			for source, constraints := range constraintsByDir[m.Dir] {
+				if constraintsByRoot[root.Dir] == nil {
+					constraintsByRoot[root.Dir] = make(map[string][]string)
+				}
+				constraintsByRoot[root.Dir][source] = append(constraintsByRoot[root.Dir][source], constraints...)
+			}
+			for source, latestVersion := range latestByDir[m.Dir] {
+				if latestByRoot[root.Dir] == nil {
+					latestByRoot[root.Dir] = make(map[string]string)
+				}
+				if current, exists := latestByRoot[root.Dir][source]; !exists || newer(latestVersion, current) {
+					latestByRoot[root.Dir][source] = latestVersion
+				}
+			}
+		}
+	}
+
+	// Provider versions shared by several directories are hashed once
+	hashes := make(map[string]*lockedHashes)
+
+	var lockDocs []*hcl.Document
+	failed := make(map[string]bool)
+	for _, dir := range sortedKeys(latestByRoot) {
+		doc, err := lockfile.Load(dir)
+		if err != nil {
+			log.Printf("Error parsing lock file in %s: %v. Skipping lock file.\n", dir, err)
+			results.Add(report.Result{File: filepath.Join(dir, lockfile.Filename), Error: err.Error()})
+			result.parseErrs++
+			failed[dir] = true
+			continue
+		}
+		if doc == nil {
+			continue
+		}
+		lockDocs = append(lockDocs, doc)
+
+		locked, err := lockfile.Providers(doc)
+		if err != nil {
+			log.Printf("Error extracting providers from lock file %s: %v. Skipping lock file.\n", doc.Filename, err)
+			results.Add(report.Result{File: doc.Filename, BlockType: report.BlockProvider, Error: err.Error()})
+			result.parseErrs++
+			failed[dir] = true
+			continue
+		}
+		entries := make(map[string]lockfile.Provider, len(locked))
+		for _, entry := range locked {
+			entries[entry.Address] = entry
+		}
+
+		for _, source := range sortedKeys(latestByRoot[dir]) {
+			address, err := provider.Address(source)
+			if err != nil {
+				continue
+			}
+			entry, exists := entries[address]
+			if !exists {
+				log.Printf("Provider %s is not locked in %s, skipping it\n", address, doc.Filename)
+				continue
+			}
+			res := report.Result{File: doc.Filename, BlockType: report.BlockProvider, BlockName: address, Source: source, Current: entry.Version}
+
+			// Every file of the tree must accept the locked version, or terraform init fails
+			latestVersion, err := lockVersion(versions, source, latestByRoot[dir][source], constraintsByRoot[dir][source])
+			if err != nil {
+				log.Printf("Warning: Failed to select the version of provider %s in %s: %v\n", address, doc.Filename, err)
+				res.Error = err.Error()
+				results.Add(res)
+				result.resolveErrs++
+				failed[dir] = true
+				continue
+			}
+			res.Latest = latestVersion
+
+			// Never move a lock file back to an older version
+			if !newer(latestVersion, entry.Version) {
+				res.Proposed = entry.Version
+				results.Add(res)
+				continue
+			}
+
+			// Lock the constraints of the module tree as they are written, like terraform init
+			if entry.Constraints, err = lockfile.Constraints(constraintsByRoot[dir][source]); err != nil {
+				log.Printf("Failed to merge constraints of provider %s in %s: %v\n", address, doc.Filename, err)
+				res.Error = err.Error()
+				results.Add(res)
+				result.parseErrs++
+				failed[dir] = true
+				continue
+			}
+			entry.Version = latestVersion
+
+			// The hashes of the new version are only needed when the lock file is shown or written
+			if write || showDiff {
+				key := address + " " + latestVersion
+				if hashes[key] == nil {
+					packageHashes, err := lockfile.Hashes(source, latestVersion, lockPlatforms)
+					hashes[key] = &lockedHashes{hashes: packageHashes, err: err}
+				}
+				if hashes[key].err != nil {
+					log.Printf("Warning: Failed to hash provider %s %s: %v\n", address, latestVersion, hashes[key].err)
+					res.Error = hashes[key].err.Error()
+					results.Add(res)
+					result.resolveErrs++
+					failed[dir] = true
+					continue
+				}
+				entry.Hashes = hashes[key].hashes
+			}
+
+			lockfile.SetProvider(doc.File, entry)
+			res.Proposed = latestVersion
+			results.Add(res)
+		}
+	}
+
+	return lockDocs, heldDirs(failed)
+}
+
+// heldDirs returns the directories of the modules of the trees of the root modules
+// whose lock file could not be updated. A root module calling one of these modules
+// is held too, since its lock file was chosen for the constraints they would have
+// been given.
+func heldDirs(failed map[string]bool) map[string]bool {
+	held := make(map[string]bool)
+	for changed := len(failed) > 0; changed; {
+		changed = false
+		for _, root := range proj.Roots() {
+			tree := proj.Tree(root)
+			hold := failed[root.Dir]
+			for _, m := range tree {
+				hold = hold || held[m.Dir]
+			}
+			if !hold {
+				continue
+			}
+			failed[root.Dir] = true
+			for _, m := range tree {
+				if !held[m.Dir] {
+					held[m.Dir] = true
+					changed = true
+				}
+			}
+		}
+	}
+	return held
+}
+
+// lockVersion returns the newest available version of a provider, up to the newest
+// version resolved for the files of a root module tree, that satisfies every constraint
+// of the tree.
+func lockVersion(versions *resolver.Resolver, source string, newest string, constraints []string) (string, error) {
+	available, err := versions.Versions(resolver.Key{Kind: resolver.KindProvider, Address: source})
+	if err != nil {
+		return "", err
+	}
+	ceiling, err := version.NewVersion(newest)
+	if err != nil {
+		return "", fmt.Errorf("invalid version '%s': %v", newest, err)
+	}
+	if len(constraints) == 0 {
+		return newest, nil
+	}
+	required, err := version.NewConstraint(strings.Join(constraints, ","))
+	if err != nil {
+		return "", fmt.Errorf("invalid constraints of %s: %v", source, err)
+	}
+
+	// Sort versions in descending order
+	sorted := make([]*version.Version, len(available))
+	copy(sorted, available)
+	sort.Sort(sort.Reverse(version.Collection(sorted)))
+
+	for _, v := range sorted {
+		if !v.GreaterThan(ceiling) && required.Check(v) {
+			return v.Original(), nil
+		}
+	}
+	return "", fmt.Errorf("no version of %s up to %s satisfies every constraint of the module tree (%s)", source, newest, strings.Join(constraints, ", "))
+}
+
+// newer reports whether version a is newer than version b. An invalid version a is
+// never newer, and any valid version is newer than an invalid version b.
+func newer(a string, b string) bool {
+	versionA, err := version.NewVersion(a)
+	if err != nil {
+		return false
+	}
+	versionB, err := version.NewVersion(b)
+	if err != nil {
+		return true
+	}
+	return versionA.GreaterThan(versionB)
+}
+
+// verifyLockFiles compares the lock file of every root module with the configuration
+// of the module and the child modules it calls. Every locked provider and every problem
+// found is recorded in the report.
+func verifyLockFiles() (summary, *report.Report) {
+	var result summary
+	results := &report.Report{}
+
+	var lockFiles []string
+	for _, root := range proj.Roots() {
+		dir := root.Dir
+		doc, err := lockfile.Load(dir)
+		if err != nil {
+			log.Printf("Error parsing lock file in %s: %v. Skipping lock file.\n", dir, err)
+			results.Add(report.Result{File: filepath.Join(dir, lockfile.Filename), Error: err.Error()})
+			result.parseErrs++
+			continue
+		}
+		if doc == nil {
+			// Only root modules that were initialized have a lock file
+			continue
+		}
+		lockFiles = append(lockFiles, doc.Filename)
+
+		locked, err := lockfile.Providers(doc)
+		if err != nil {
+			results.Add(report.Result{File: doc.Filename, BlockType: report.BlockProvider, Error: err.Error()})
+			result.parseErrs++
+			continue
+		}
+		config, err := loadConfig(dir)
+		if err != nil {
+			log.Printf("Error loading the configuration of %s: %v. Skipping lock file.\n", dir, err)
+			results.Add(report.Result{File: doc.Filename, Error: err.Error()})
+			result.parseErrs++
+			continue
+		}
+		if !config.Complete {
+			log.Printf("Warning: Remote modules of %s are not installed, stale lock entries are not reported\n", dir)
+		}
+
+		// Report every problem, then the consistent entries
+		versions := make(map[string]string, len(locked))
+		for _, entry := range locked {
+			versions[entry.Address] = entry.Version
+		}
+		inconsistent := make(map[string]bool)
+		for _, problem := range lockfile.Verify(locked, config, lockPlatforms) {
+			entry := report.Result{File: doc.Filename, BlockType: report.BlockProvider, BlockName: problem.Address,
+				Current: versions[problem.Address], Proposed: problem.Constraint, Error: problem.Detail}
+			if problem.Kind == lockfile.ProblemLookup {
+				result.resolveErrs++
+			} else {
+				entry.Action = report.ActionInconsistent
+			}
+			inconsistent[problem.Address] = true
+			results.Add(entry)
+		}
+		for _, entry := range locked {
+			if !inconsistent[entry.Address] {
+				results.Add(report.Result{File: doc.Filename, BlockType: report.BlockProvider, BlockName: entry.Address, Current: entry.Version})
+			}
+		}
+		for _, entry := range results.Results {
+			if entry.File == doc.Filename && entry.Action == report.ActionInconsistent {
+				result.outdated++
+				break
+			}
+		}
+	}
+
+	results.SortByFile(lockFiles)
+	return result, results
+}
+
+// loadConfig collects the provider requirements of a root module and of every child
+// module it calls. Local modules are followed through their source path, and remote
+// modules through the manifest written by terraform init; without a manifest, the
+// configuration of remote modules is unknown and the result is incomplete.
+func loadConfig(root string) (lockfile.Config, error) {
+	config := lockfile.Config{Complete: true}
+
+	manifest, err := module.ReadManifest(root)
+	if err != nil {
+		return config, err
+	}
+	dirs := []string{root}
+	for _, entry := range manifest {
+		dirs = append(dirs, filepath.Join(root, entry.Dir))
+	}
+
+	used := make(map[string]bool)
+	visited := make(map[string]bool)
+	for len(dirs) > 0 {
+		dir := filepath.Clean(dirs[0])
+		dirs = dirs[1:]
+		if visited[dir] {
+			continue
+		}
+		visited[dir] = true
+
+		// Parse every file of the module
+		paths, err := moduleFiles(dir)
+		if err != nil {
+			return config, err
+		}
+		var contents []*hcl2.BodyContent
+		for _, path := range paths {
+			doc, err := hcl.Load(path)
+			if err != nil {
+				return config, err
+			}
+			contents = append(contents, doc.Content)
+		}
+
+		// Local names are declared per module
+		sources := provider.Sources(contents...)
+		for _, content := range contents {
+			requirements, err := provider.Extract(content, sources)
+			if err != nil {
+				return config, err
+			}
+			config.Requirements = append(config.Requirements, requirements...)
+
+			// Follow the calls to child modules
+			calls, err := module.Extract(content)
+			if err != nil {
+				return config, err
+			}
+			for _, call := range calls {
+				src, err := module.ParseSource(call["source"])
+				switch {
+				case err == nil && src.Type == module.SourceLocal:
+					dirs = append(dirs, filepath.Join(dir, call["source"]))
+				case manifest == nil:
+					config.Complete = false
+				}
+			}
+		}
+		for _, source := range provider.Used(contents...) {
+			used[source] = true
+		}
+	}
+
+	config.Used = sortedKeys(used)
+	return config, nil
+}
+
+// moduleFiles returns the .tf and .tofu files of a module directory.
+func moduleFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, entry := range entries {
+		if ext := filepath.Ext(entry.Name()); !entry.IsDir() && (ext == ".tf" || ext == ".tofu") {
+			paths = append(paths, filepath.Join(dir, entry.Name()))
+		}
+	}
+	return paths, nil
+}
+
+func init() {
+	lockCmd.AddCommand(lockVerifyCmd)
+	rootCmd.AddCommand(lockCmd)
+}
@@ -6,13 +6,26 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"runtime"
+	"sort"
 	"strings"
+	"time"
 
+	"tfau/lib/constraint"
+	"tfau/lib/diff"
 	"tfau/lib/hcl"
+	"tfau/lib/httpcache"
+	"tfau/lib/index"
 	"tfau/lib/module"
+	"tfau/lib/project"
 	"tfau/lib/provider"
+	"tfau/lib/registry"
+	"tfau/lib/report"
+	"tfau/lib/resolver"
+	"tfau/lib/semver"
 	"tfau/lib/terraform"
 
+	hcl2 "github.com/hashicorp/hcl/v2"
 	"github.com/spf13/cobra"
 )
 
@@ -24,46 +37,141 @@ var (
 	providers        = true
 	modules          = true
 	tf               = true
-	terraformVersion string // Desired Terraform version
+	terraformVersion string        // Desired Terraform version
+	maxBump          string        // Largest upgrade allowed (patch, minor, major)
+	allowPrerelease  bool          // Allow prereleases for every dependency
+	prereleaseFor    []string      // Dependencies allowed to pick prereleases
+	dryRun           bool          // Resolve versions and print a diff without writing files
+	output           string        // Report format (text, json)
+	jobs             int           // Number of concurrent version lookups
+	cacheDir         string        // Directory of the HTTP cache
+	cacheTTL         time.Duration // How long cached responses are used without revalidation
+	refresh          bool          // Bypass the HTTP cache
+	offline          bool          // Resolve only from the index or the HTTP cache
+	indexFile        string        // Version index to resolve from
+	tofu             bool          // Resolve against OpenTofu instead of Terraform
+	expandProviders  bool          // Convert short-form required_providers entries to the object form
+	tagPatternFlags  []string      // Git tag patterns as source=regex
+	tagPatterns      map[string]string
+	sshKeyFiles      []string         // Private keys for SSH Git sources
+	knownHostsFiles  []string         // known_hosts files for SSH Git sources
+	updateLock       bool             // Update the .terraform.lock.hcl files
+	lockPlatforms    []string         // Platforms to hash provider packages for in lock files
+	include          []string         // Patterns of the files searched
+	exclude          []string         // Additional patterns of the paths never searched
+	gitIgnore        bool             // Skip the paths ignored by Git
+	versionIndex     *index.Index     // Loaded --index file
+	proj             *project.Project // Modules of the files
+	policy           semver.Policy
 )
 
-// findTFFiles recursively finds all .tf files in the given directory
-func findTFFiles(dir string) ([]string, error) {
-	var tfFiles []string
-	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-		if !info.IsDir() && filepath.Ext(path) == ".tf" {
-			tfFiles = append(tfFiles, path)
-		}
-		return nil
-	})
-	return tfFiles, err
-}
+// pathArgs annotates the commands whose arguments are the paths to search for files.
+const pathArgs = "paths"
 
 var rootCmd = &cobra.Command{
-	Use:   "tfau",
+	Use:   "tfau [path...]",
 	Short: "A CLI tool to easily upgrade your Terraform modules and providers.",
 	Long: `Given a Terraform project and command line parameters,
-tfau upgrades each provider, module, and Terraform version in place in your HCL files.`,
-	PreRunE: func(cmd *cobra.Command, args []string) error {
+tfau upgrades each provider, module, and Terraform version in place in your HCL files.
+The directories, files and glob patterns given as arguments are searched, or the
+working directory when neither arguments nor --file are given.`,
+	Args:        cobra.ArbitraryArgs,
+	Annotations: map[string]string{pathArgs: "true"},
+	// Errors are reported by main, which also picks the exit code
+	SilenceErrors: true,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
 		log.Println("Files:", files)
 
-		// If no files are specified, find all .tf files recursively
-		if len(files) == 0 {
+		// Use the settings of the configuration file for the flags not given
+		if err := applyConfig(cmd); err != nil {
+			return err
+		}
+
+		// Search the paths given as arguments, or the working directory when no file is
+		// specified either, and group every file into modules
+		project.Exclude = append(project.Exclude, exclude...)
+		project.Include = include
+		project.GitIgnore = gitIgnore
+		var paths []string
+		if cmd.Annotations[pathArgs] != "" {
+			paths = args
+		}
+		if len(files) == 0 && len(paths) == 0 {
 			recursive = true
 			cwd, err := os.Getwd()
 			if err != nil {
 				return fmt.Errorf("failed to get current working directory: %v", err)
 			}
-			tfFiles, err := findTFFiles(cwd)
+			paths = []string{cwd}
+		}
+		found, err := project.Find(paths...)
+		if err != nil {
+			return fmt.Errorf("failed to find .tf and .tofu files: %v", err)
+		}
+		files = append(files, found...)
+		proj = project.Load(files)
+		log.Println("Recursive:", recursive)
+
+		// Validate the output format
+		if output != "text" && output != "json" {
+			return fmt.Errorf("unknown output format: %s (expected text or json)", output)
+		}
+
+		// Configure the HTTP cache shared by the registry and release lookups
+		httpcache.Default.Dir = cacheDir
+		httpcache.Default.TTL = cacheTTL
+		httpcache.Default.Refresh = refresh
+		httpcache.Default.Offline = offline
+		httpcache.Default.Token = registry.RequestToken
+
+		// Resolve modules, providers and the tool version against OpenTofu
+		if tofu {
+			registry.DefaultHost = registry.OpenTofuHost
+			terraform.Target = terraform.DistributionOpenTofu
+		}
+
+		// Load the version index, if any
+		if indexFile != "" {
+			idx, err := index.Load(indexFile)
 			if err != nil {
-				return fmt.Errorf("failed to find .tf files: %v", err)
+				return err
+			}
+			if err := idx.Check(string(terraform.Target), registry.DefaultHost); err != nil {
+				return fmt.Errorf("cannot use index file %s: %v", indexFile, err)
 			}
-			files = tfFiles
+			for address, tags := range idx.Commits {
+				if err := module.StoreTagCommits(address, tags); err != nil {
+					return fmt.Errorf("invalid commits in index file %s: %v", indexFile, err)
+				}
+			}
+			versionIndex = idx
+		}
+
+		// Parse the upgrade ceiling shared by all resolvers
+		bump, err := semver.ParseBump(maxBump)
+		if err != nil {
+			return err
+		}
+		policy.MaxBump = bump
+		policy.AllowPrerelease = allowPrerelease
+		policy.PrereleaseFor = prereleaseFor
+
+		// Configure the Git authentication
+		module.SSHKeyFiles = sshKeyFiles
+		module.KnownHostsFiles = knownHostsFiles
+
+		// Parse the Git tag patterns
+		tagPatterns = make(map[string]string)
+		for _, flag := range tagPatternFlags {
+			source, pattern, ok := strings.Cut(flag, "=")
+			if !ok || source == "" {
+				return fmt.Errorf("invalid tag pattern '%s' (expected source=regex)", flag)
+			}
+			if err := module.ValidateTagPattern(pattern); err != nil {
+				return err
+			}
+			tagPatterns[source] = pattern
 		}
-		log.Println("Recursive:", recursive)
 
 		// If upgrades are not specified, default to upgrading all (modules, providers, terraform)
 		// otherwise process specified upgrades only
@@ -78,117 +186,415 @@ tfau upgrades each provider, module, and Terraform version in place in your HCL
 		return nil
 	},
 	RunE: func(cmd *cobra.Command, args []string) error {
-		// Iterate over each file and parse modules
-		for _, file := range files {
-			log.Printf("Processing file: %s\n", file)
+		// Failures past this point are not usage errors
+		cmd.SilenceUsage = true
 
-			// Parse the .tf file and extract the content based on the schema
-			content, err := hcl.ParseFile(file)
+		// Upgrade every file, writing the changes unless in dry-run mode
+		result, results := processFiles(!dryRun, dryRun && output == "text")
+		if err := writeReport(results); err != nil {
+			return err
+		}
+		return result.err(false)
+	},
+}
+
+// summary counts the outcomes of a run; it decides the process exit code.
+type summary struct {
+	outdated    int // Files with at least one outdated dependency
+	resolveErrs int // Failed version lookups
+	parseErrs   int // Files or blocks that could not be parsed or rewritten
+	writeErrs   int // Files that could not be written
+}
+
+// err converts the summary to an error carrying the matching exit code. Outdated
+// dependencies are only an error in check mode.
+func (s summary) err(check bool) error {
+	switch {
+	case s.parseErrs > 0:
+		return &ExitError{Code: ExitParseError, Err: fmt.Errorf("%d parse error(s)", s.parseErrs)}
+	case s.resolveErrs > 0:
+		return &ExitError{Code: ExitResolutionError, Err: fmt.Errorf("%d version lookup(s) failed", s.resolveErrs)}
+	case s.writeErrs > 0:
+		return fmt.Errorf("%d file(s) could not be written", s.writeErrs)
+	case check && s.outdated > 0:
+		return &ExitError{Code: ExitOutdated, Err: fmt.Errorf("%d file(s) out of date", s.outdated)}
+	}
+	return nil
+}
+
+// filePlan holds a loaded file and the dependencies extracted from it.
+type filePlan struct {
+	doc              *hcl.Document
+	modules          map[string]map[string]string // Module name -> {source, version}
+	providers        []provider.Requirement       // Provider version constraints
+	terraformVersion string                       // Current required_version
+	latestProviders  map[string]string            // Provider source -> resolved latest version
+	moduleSources    map[string]string            // Local name -> source, across the files of the module
+}
+
+// newResolver creates the resolver configured by the index and offline flags.
+func newResolver() *resolver.Resolver {
+	versions := resolver.New(jobs)
+	versions.Offline = offline
+	versions.Index = versionIndex
+	return versions
+}
+
+// loadFiles loads every file and registers the dependencies found in them with the
+// resolver. Files that cannot be parsed are recorded in the report and skipped.
+func loadFiles(versions *resolver.Resolver, results *report.Report, result *summary) []*filePlan {
+	var plans []*filePlan
+	for _, file := range files {
+		log.Printf("Processing file: %s\n", file)
+
+		// Read and parse the .tf file once, every upgrader edits the same document
+		doc, err := hcl.Load(file)
+		if err != nil {
+			log.Printf("Error parsing file %s: %v. Skipping file.\n", file, err)
+			results.Add(report.Result{File: file, Error: err.Error()})
+			result.parseErrs++
+			continue // Skip to the next file
+		}
+		plans = append(plans, &filePlan{doc: doc})
+	}
+
+	// The local names of providers are declared once per module, often in another file
+	contentsByDir := make(map[string][]*hcl2.BodyContent)
+	for _, plan := range plans {
+		dir := filepath.Dir(plan.doc.Filename)
+		contentsByDir[dir] = append(contentsByDir[dir], plan.doc.Content)
+	}
+	sourcesByDir := make(map[string]map[string]string, len(contentsByDir))
+	for dir, contents := range contentsByDir {
+		sourcesByDir[dir] = provider.Sources(contents...)
+	}
+
+	for _, plan := range plans {
+		file, doc := plan.doc.Filename, plan.doc
+		plan.moduleSources = sourcesByDir[filepath.Dir(file)]
+		var err error
+
+		log.Println("Modules:", modules)
+		if modules {
+			// Extract modules
+			plan.modules, err = module.Extract(doc.Content)
+			if err != nil {
+				log.Printf("Error extracting modules from file %s: %v. Skipping modules.\n", file, err)
+				results.Add(report.Result{File: file, BlockType: report.BlockModule, Error: err.Error()})
+				result.parseErrs++
+			}
+			for _, info := range plan.modules {
+				// Local paths, archives and buckets have no versions to look up
+				if module.Versioned(info["source"]) && !rules.Ignores(module.Address(info["source"])) {
+					key, _ := moduleKey(info["source"])
+					versions.Add(key)
+					module.UseSourceCredentials(info["source"])
+				}
+			}
+		}
+
+		log.Println("Providers:", providers)
+		if providers {
+			// Extract providers
+			plan.providers, err = provider.Extract(doc.Content, plan.moduleSources)
 			if err != nil {
-				log.Printf("Error parsing file %s: %v. Skipping file.\n", file, err)
-				continue // Skip to the next file
+				log.Printf("Error extracting providers from file %s: %v. Skipping providers.\n", file, err)
+				results.Add(report.Result{File: file, BlockType: report.BlockProvider, Error: err.Error()})
+				result.parseErrs++
 			}
+			for _, requirement := range plan.providers {
+				if !rules.Ignores(requirement.Source) {
+					versions.Add(resolver.Key{Kind: resolver.KindProvider, Address: requirement.Source})
+				}
+			}
+		}
+
+		log.Println("Terraform:", tf)
+		if tf && terraformVersion == "" {
+			// Extract the Terraform version
+			plan.terraformVersion, err = terraform.Extract(doc.Content)
+			if err != nil {
+				log.Printf("Error extracting Terraform version from file %s: %v. Skipping Terraform version update.\n", file, err)
+				results.Add(report.Result{File: file, BlockType: report.BlockTerraform, BlockName: "required_version", Error: err.Error()})
+				result.parseErrs++
+			}
+			if plan.terraformVersion != "" && !rules.Ignores(resolver.TerraformAddress) {
+				versions.Add(resolver.Key{Kind: resolver.KindTerraform, Address: resolver.TerraformAddress})
+			}
+		}
+	}
+
+	return plans
+}
+
+// processFiles resolves the latest versions for every file and computes the updated
+// content. The content is written back when write is set, and shown as a unified diff
+// when showDiff is set. Every dependency found is recorded in the report.
+func processFiles(write bool, showDiff bool) (summary, *report.Report) {
+	var result summary
+	results := &report.Report{}
+	versions := newResolver()
 
-			log.Println("Modules:", modules)
-			if modules {
-				// Extract modules
-				modules, err := module.Extract(content)
+	// Load every file and collect the unique dependencies across all of them
+	plans := loadFiles(versions, results, &result)
+
+	// Fetch the versions of every unique dependency concurrently
+	versions.Resolve()
+
+	// Upgrade each file with the shared answers
+	for _, plan := range plans {
+		file, doc := plan.doc.Filename, plan.doc
+
+		if len(plan.modules) > 0 {
+			// Create a map to store the latest versions
+			latestVersions := make(map[string]string)
+
+			// Select the latest version for each module, in a stable order
+			for _, name := range sortedKeys(plan.modules) {
+				info := plan.modules[name]
+				source := info["source"]
+				entry := report.Result{File: file, BlockType: report.BlockModule, BlockName: name, Source: source, Current: info["version"]}
+
+				// Report sources that cannot be parsed, and skip sources without versions
+				src, err := module.ParseSource(source)
 				if err != nil {
-					log.Printf("Error extracting modules from file %s: %v. Skipping modules.\n", file, err)
-				} else {
-					// Create a map to store the latest versions
-					latestVersions := make(map[string]string)
-
-					// Fetch the latest version for each module
-					for name, info := range modules {
-						source := info["source"]
-						if source != "" {
-							latestVersion, err := module.GetLatestModuleVersion(source)
-							if err != nil {
-								log.Printf("Warning: Failed to retrieve latest version for module '%s' in file %s: %v\n", name, file, err)
-							} else {
-								latestVersions[name] = latestVersion
-								fmt.Printf("Module: %s, Current Version: %s, Latest Version: %s\n", name, info["version"], latestVersion)
-							}
-						}
+					entry.Error = err.Error()
+					results.Add(entry)
+					result.parseErrs++
+					continue
+				}
+				if !src.Versioned() {
+					log.Printf("Skipping module '%s' in file %s: %s sources have no versions\n", name, file, src.Type)
+					continue
+				}
+				if ignored(src.Address(), file) {
+					entry.Action = report.ActionIgnored
+					results.Add(entry)
+					continue
+				}
+
+				// Commits are compared by the tag they are released as; an untagged commit
+				// may be ahead of every release, so it is left alone
+				key, pattern := moduleKey(source)
+				current := info["version"]
+				if src.Type == module.SourceGit && module.IsCommitSHA(current) {
+					if current, err = module.CommitTag(source, current, pattern); err != nil {
+						log.Printf("Warning: Failed to find the release of module '%s' in file %s: %v\n", name, file, err)
+						entry.Error = err.Error()
+						results.Add(entry)
+						result.resolveErrs++
+						continue
 					}
+					if current == "" {
+						log.Printf("Skipping module '%s' in file %s: commit %s is not a release\n", name, file, info["version"])
+						entry.Action, entry.Reason = report.ActionSkipped, "no release tag points to the commit"
+						results.Add(entry)
+						continue
+					}
+				}
 
-					log.Printf("Latest versions to update in file %s: %v", file, latestVersions)
+				// Git refs are compared and rewritten without their tag prefix
+				latestVersion, err := versions.Latest(key, module.TagVersion(current, pattern), policyFor(key.Address))
+				if err != nil {
+					log.Printf("Warning: Failed to retrieve latest version for module '%s' in file %s: %v\n", name, file, err)
+					entry.Error = err.Error()
+					results.Add(entry)
+					result.resolveErrs++
+					continue
+				}
+				latestVersion = module.TagName(current, pattern, latestVersion)
+				latestVersions[name] = latestVersion
+				entry.Latest = latestVersion
 
-					// Update the module versions in the file
-					err = module.UpdateModuleVersions(file, latestVersions)
-					if err != nil {
-						log.Printf("Failed to update module versions in file %s: %v\n", file, err)
-					} else {
-						log.Println("Updated module versions in the file.")
+				// Record the version the updater will write
+				if entry.Proposed, err = module.ProposedVersion(source, info["version"], latestVersion); err != nil {
+					entry.Error = err.Error()
+					if src.Type == module.SourceGit {
+						// The commit of the tag could not be looked up
+						result.resolveErrs++
 					}
 				}
+				results.Add(entry)
 			}
 
-			log.Println("Providers:", providers)
-			if providers {
-				// Extract providers and their latest versions
-				currentVersions, latestVersions, err := provider.ExtractWithLatestVersions(content)
+			log.Printf("Latest versions to update in file %s: %v", file, latestVersions)
+
+			// Update the module versions in the document
+			module.UpdateModuleVersions(doc.File, latestVersions)
+		}
+
+		if len(plan.providers) > 0 {
+			// Select the latest version for each provider source
+			latestVersions := make(map[string]string)
+			for _, requirement := range plan.providers {
+				version := requirement.Version
+				entry := report.Result{File: file, BlockType: requirement.BlockType, BlockName: requirement.Name, Source: requirement.Source, Current: version}
+				if ignored(requirement.Source, file) {
+					entry.Action = report.ActionIgnored
+					results.Add(entry)
+					continue
+				}
+
+				key := resolver.Key{Kind: resolver.KindProvider, Address: requirement.Source}
+				latestVersion, err := versions.Latest(key, version, policyFor(key.Address))
 				if err != nil {
-					log.Printf("Error extracting providers from file %s: %v. Skipping providers.\n", file, err)
-				} else {
-					if len(currentVersions) == 0 {
-						log.Println("No provider blocks found in the file.")
-					} else {
-						// Print current and latest versions
-						for name, version := range currentVersions {
-							latestVersion := latestVersions[name]
-							fmt.Printf("Provider: %s, Current Version: %s, Latest Version: %s\n", name, version, latestVersion)
-						}
-
-						// Update the provider versions in the file
-						err := provider.UpdateProviderVersions(file, latestVersions)
-						if err != nil {
-							log.Printf("Failed to update provider versions in file %s: %v\n", file, err)
-						} else {
-							log.Println("Updated provider versions in the file.")
-						}
-					}
+					log.Printf("Warning: Failed to retrieve latest version for provider '%s' in file %s: %v\n", requirement.Source, file, err)
+					entry.Error = err.Error()
+					results.Add(entry)
+					result.resolveErrs++
+					continue
 				}
+				latestVersions[requirement.Source] = latestVersion
+				entry.Latest = latestVersion
+
+				// Record the constraint the updater will write
+				if entry.Proposed, err = constraint.Rewrite(version, latestVersion); err != nil {
+					entry.Error = err.Error()
+				}
+				results.Add(entry)
 			}
 
-			log.Println("Terraform:", tf)
-			if tf {
-				if terraformVersion != "" {
-					log.Printf("Terraform version specified: %s\n", terraformVersion)
-					// Update the required_version in the file with the specified version
-					err := terraform.UpdateRequiredVersion(file, terraformVersion)
-					if err != nil {
-						log.Printf("Failed to update required_version in file %s: %v\n", file, err)
-					} else {
-						log.Printf("Updated required_version to %s in the file.\n", terraformVersion)
-					}
+			// Update the provider versions in the document, and later in the lock file
+			provider.UpdateProviderVersions(doc.File, latestVersions, plan.moduleSources)
+			plan.latestProviders = latestVersions
+		}
+
+		// Convert short-form required_providers entries to the object form
+		if providers && expandProviders {
+			provider.ExpandRequiredProviders(doc.File)
+		}
+
+		if tf {
+			entry := report.Result{File: file, BlockType: report.BlockTerraform, BlockName: "required_version"}
+			if terraformVersion != "" {
+				log.Printf("Terraform version specified: %s\n", terraformVersion)
+				entry.Current, _ = terraform.Extract(doc.Content)
+				entry.Proposed = terraformVersion
+
+				// Update the required_version in the document with the specified version;
+				// files without a terraform block have nothing to report
+				if terraform.UpdateRequiredVersion(doc.File, terraformVersion) {
+					results.Add(entry)
+				}
+			} else if plan.terraformVersion != "" && ignored(resolver.TerraformAddress, file) {
+				entry.Current, entry.Action = plan.terraformVersion, report.ActionIgnored
+				results.Add(entry)
+			} else if plan.terraformVersion != "" {
+				entry.Current = plan.terraformVersion
+
+				key := resolver.Key{Kind: resolver.KindTerraform, Address: resolver.TerraformAddress}
+				latestVersion, err := versions.Latest(key, plan.terraformVersion, policyFor(key.Address))
+				if err != nil {
+					log.Printf("Warning: Failed to retrieve latest Terraform version for file %s: %v\n", file, err)
+					entry.Error = err.Error()
+					result.resolveErrs++
+				} else if newVersion, err := constraint.Rewrite(plan.terraformVersion, latestVersion); err != nil {
+					// Rewrite the constraint to the latest version, keeping its style
+					log.Printf("Failed to rewrite required_version '%s' in file %s: %v\n", plan.terraformVersion, file, err)
+					entry.Latest, entry.Error = latestVersion, err.Error()
+					result.parseErrs++
 				} else {
-					// Extract Terraform version and fetch the latest version
-					currentVersion, latestVersion, err := terraform.ExtractWithLatestVersion(content)
-					if err != nil {
-						log.Printf("Error extracting Terraform version from file %s: %v. Skipping Terraform version update.\n", file, err)
-					} else {
-						if currentVersion == "" {
-							log.Println("No Terraform version specified in the file.")
-						} else {
-							fmt.Printf("Terraform Version: %s, Latest Version: %s\n", currentVersion, latestVersion)
-
-							// Update the required_version in the file with the latest version
-							err := terraform.UpdateRequiredVersion(file, latestVersion)
-							if err != nil {
-								log.Printf("Failed to update required_version in file %s: %v\n", file, err)
-							} else {
-								log.Printf("Updated required_version to %s in the file.\n", latestVersion)
-							}
-						}
-					}
+					// Update the required_version in the document with the rewritten constraint
+					terraform.UpdateRequiredVersion(doc.File, newVersion)
+					entry.Latest, entry.Proposed = latestVersion, newVersion
 				}
+				results.Add(entry)
 			}
 		}
 
-		return nil
-	},
+	}
+
+	// Lock the new provider versions in the lock file of each directory before saving
+	// anything, so that a module tree is either upgraded with its lock file or left alone
+	lockDocs, held := updateLockFiles(plans, versions, write, showDiff, results, &result)
+	docs := make([]*hcl.Document, 0, len(plans)+len(lockDocs))
+	for _, plan := range plans {
+		docs = append(docs, plan.doc)
+	}
+	var lockFiles []string
+	for _, doc := range lockDocs {
+		docs = append(docs, doc)
+		lockFiles = append(lockFiles, doc.Filename)
+	}
+	for _, doc := range docs {
+		if held[filepath.Dir(doc.Filename)] && doc.Changed() && (write || showDiff) {
+			log.Printf("Not saving file %s: the lock file of its root module could not be updated\n", doc.Filename)
+			saveDocument(doc, false, false, results, &result)
+			continue
+		}
+		saveDocument(doc, write, showDiff, results, &result)
+	}
+
+	// Group the results by file, in the order the files were given
+	results.SortByFile(append(append([]string{}, files...), lockFiles...))
+
+	return result, results
+}
+
+// saveDocument counts a document with an outdated dependency as outdated, shows its diff
+// when showDiff is set and writes it back when write is set. Edits that upgrade nothing,
+// such as expanded required_providers entries, are written but never make a file
+// outdated. Unchanged documents are left alone.
+func saveDocument(doc *hcl.Document, write bool, showDiff bool, results *report.Report, result *summary) {
+	file := doc.Filename
+	if results.Outdated(file) {
+		result.outdated++
+	}
+
+	// Nothing left to do when the document was not edited
+	if !doc.Changed() {
+		return
+	}
+
+	// Show what would change
+	if showDiff {
+		fmt.Print(diff.Unified(file, doc.Original, doc.Bytes()))
+	}
+
+	// Write all the edits back to the file at once
+	if write {
+		if err := doc.Save(); err != nil {
+			log.Printf("Failed to write file %s: %v\n", file, err)
+			results.Add(report.Result{File: file, Error: err.Error()})
+			result.writeErrs++
+		} else {
+			results.MarkUpdated(file)
+		}
+	}
+}
+
+// moduleKey returns the resolver key of a module and, for Git modules, the pattern
+// selecting the tags that version it (configured with --tag-pattern or inferred from
+// the prefix of the current ref, or of the tags of the commit it is pinned to).
+func moduleKey(source string) (resolver.Key, string) {
+	pattern := ""
+	if src, err := module.ParseSource(source); err == nil && src.Type == module.SourceGit {
+		pattern = module.TagPattern(source, src.Ref(), tagPatterns)
+		if pattern == "" && module.IsCommitSHA(src.Ref()) {
+			pattern = module.CommitTagPattern(source, src.Ref())
+		}
+	}
+	return resolver.Key{Kind: resolver.KindModule, Address: module.TaggedAddress(module.Address(source), pattern)}, pattern
+}
+
+// sortedKeys returns the keys of a map in lexical order.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// writeReport prints the report on stdout in the format selected by --output.
+func writeReport(results *report.Report) error {
+	switch output {
+	case "json":
+		return results.WriteJSON(os.Stdout)
+	default:
+		return results.WriteText(os.Stdout)
+	}
 }
 
 func parseUpgradeOption(upgrades string) error {
@@ -220,14 +626,61 @@ func Execute() error {
 
 func init() {
 	// Files flag (optional)
-	rootCmd.Flags().StringArrayVarP(&files, "file", "f", []string{}, "HCL file(s) to be updated")
+	rootCmd.PersistentFlags().StringArrayVarP(&files, "file", "f", []string{}, "HCL file(s) to be updated")
 
 	// Upgrades flag (optional)
-	rootCmd.Flags().StringVar(&upgrades, "upgrades", "", "Comma-separated list of upgrades (modules, providers, terraform)")
+	rootCmd.PersistentFlags().StringVar(&upgrades, "upgrades", "", "Comma-separated list of upgrades (modules, providers, terraform)")
 
 	// Verbose flag (optional)
-	rootCmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Enable verbose output")
+	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "Enable verbose output")
 
 	// Terraform version flag (optional)
-	rootCmd.Flags().StringVar(&terraformVersion, "terraform-version", "", "Desired Terraform version to update to (e.g., '~>1.9')")
+	rootCmd.PersistentFlags().StringVar(&terraformVersion, "terraform-version", "", "Desired Terraform version to update to (e.g., '~>1.9')")
+
+	// Max bump flag (optional)
+	rootCmd.PersistentFlags().StringVar(&maxBump, "max-bump", "major", "Largest upgrade allowed relative to the current version (patch, minor, major)")
+
+	// Output flag (optional)
+	rootCmd.PersistentFlags().StringVarP(&output, "output", "o", "text", "Report format (text, json)")
+
+	// Jobs flag (optional)
+	rootCmd.PersistentFlags().IntVarP(&jobs, "jobs", "j", 8, "Number of concurrent version lookups")
+
+	// Cache flags (optional)
+	rootCmd.PersistentFlags().StringVar(&cacheDir, "cache-dir", httpcache.DefaultDir(), "Directory of the registry and release response cache (empty to disable)")
+	rootCmd.PersistentFlags().DurationVar(&cacheTTL, "cache-ttl", time.Hour, "How long cached responses are used before being revalidated")
+	rootCmd.PersistentFlags().BoolVar(&refresh, "refresh", false, "Bypass the cache and fetch every response again")
+
+	// Offline flags (optional)
+	rootCmd.PersistentFlags().BoolVar(&offline, "offline", false, "Resolve versions only from the cache or the --index file, never from the network")
+	rootCmd.PersistentFlags().StringVar(&indexFile, "index", "", "Version index file (from 'tfau index export') to resolve versions from")
+
+	// OpenTofu flag (optional)
+	rootCmd.PersistentFlags().BoolVar(&tofu, "tofu", false, "Resolve modules and providers from registry.opentofu.org and the version from OpenTofu releases")
+
+	// Expand providers flag (optional)
+	rootCmd.PersistentFlags().BoolVar(&expandProviders, "expand-providers", false, "Convert short-form required_providers entries (google = \"~> 6.0\") to { source, version } objects")
+
+	// Tag pattern flag (optional)
+	rootCmd.PersistentFlags().StringArrayVar(&tagPatternFlags, "tag-pattern", []string{}, "Only consider the Git tags of a module source matching a regex, with the version in the first group (e.g., 'git::https://example.com/infra.git=^network/(v.*)$')")
+
+	// Git SSH flags (optional)
+	rootCmd.PersistentFlags().StringArrayVar(&sshKeyFiles, "ssh-key", []string{}, "Private key file for SSH Git sources, tried before the SSH agent")
+	rootCmd.PersistentFlags().StringArrayVar(&knownHostsFiles, "ssh-known-hosts", []string{}, "known_hosts file to check SSH host keys against (default $SSH_KNOWN_HOSTS or ~/.ssh/known_hosts)")
+
+	// File selection flags (optional)
+	rootCmd.PersistentFlags().StringArrayVar(&include, "include", []string{}, "Only search the .tf and .tofu files matching a glob, relative to the working directory (e.g., 'envs/**/main.tf')")
+	rootCmd.PersistentFlags().StringArrayVar(&exclude, "exclude", []string{}, "Never search the files and directories matching a glob, in addition to .terraform, .git, .terragrunt-cache and node_modules")
+	rootCmd.PersistentFlags().BoolVar(&gitIgnore, "gitignore", true, "Skip the files and directories ignored by Git")
+
+	// Lock file flags (optional)
+	rootCmd.PersistentFlags().BoolVar(&updateLock, "lock", true, "Update the provider versions, constraints and hashes of the .terraform.lock.hcl of the root modules")
+	rootCmd.PersistentFlags().StringArrayVar(&lockPlatforms, "lock-platform", []string{runtime.GOOS + "_" + runtime.GOARCH}, "Platform (os_arch) to record h1: hashes of provider packages for in lock files")
+
+	// Dry-run flag (optional)
+	rootCmd.Flags().BoolVar(&dryRun, "dry-run", false, "Resolve versions and print a unified diff without writing any file")
+
+	// Prerelease flags (optional)
+	rootCmd.PersistentFlags().BoolVar(&allowPrerelease, "allow-prerelease", false, "Allow alpha, beta and RC versions for every dependency")
+	rootCmd.PersistentFlags().StringArrayVar(&prereleaseFor, "prerelease-for", []string{}, "Allow prereleases for a single dependency (e.g., 'hashicorp/google', 'terraform')")
 }
@@ -0,0 +1,154 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"tfau/lib/semver"
+
+	"github.com/hashicorp/go-version"
+	"github.com/hashicorp/hcl/v2/gohcl"
+	"github.com/hashicorp/hcl/v2/hclparse"
+)
+
+// Filename is the name of the configuration file of a project.
+const Filename = ".tfau.hcl"
+
+// Config is the content of a configuration file. Every setting is optional; unset
+// settings keep the default of their command line flag, and flags given on the command
+// line take precedence over the file.
+type Config struct {
+	Upgrades        []string          `hcl:"upgrades,optional"`         // Upgrade kinds (modules, providers, terraform)
+	MaxBump         *string           `hcl:"max_bump,optional"`         // Largest upgrade allowed
+	AllowPrerelease *bool             `hcl:"allow_prerelease,optional"` // Allow prereleases for every dependency
+	PrereleaseFor   []string          `hcl:"prerelease_for,optional"`   // Dependencies allowed to pick prereleases
+	Tofu            *bool             `hcl:"tofu,optional"`             // Resolve against the OpenTofu registry and releases
+	TagPatterns     map[string]string `hcl:"tag_patterns,optional"`     // Git tag patterns by source
+	Include         []string          `hcl:"include,optional"`          // Patterns of the files searched
+	Exclude         []string          `hcl:"exclude,optional"`          // Patterns of the paths never searched
+	GitIgnore       *bool             `hcl:"gitignore,optional"`        // Skip the paths ignored by Git
+	Lock            *bool             `hcl:"lock,optional"`             // Update the lock files
+	LockPlatforms   []string          `hcl:"lock_platforms,optional"`   // Platforms to hash provider packages for
+	ExpandProviders *bool             `hcl:"expand_providers,optional"` // Convert short-form required_providers entries
+	Registries      []Registry        `hcl:"registry,block"`            // Per-host registry settings
+	Dependencies    []Dependency      `hcl:"dependency,block"`          // Per-dependency rules
+
+	// Dir is the directory of the file, which its paths are relative to
+	Dir string
+}
+
+// Registry is a registry block: the settings of a registry host.
+type Registry struct {
+	Host     string            `hcl:"host,label"`
+	Services map[string]string `hcl:"services"` // Service URLs (modules.v1, providers.v1), instead of service discovery
+}
+
+// Dependency is a dependency block: the rules of the dependencies whose source address
+// matches its label (see MatchSource).
+type Dependency struct {
+	Source          string  `hcl:"source,label"`
+	Ignore          bool    `hcl:"ignore,optional"`           // Never upgrade the dependencies
+	Below           *string `hcl:"below,optional"`            // Hold the dependencies below a version
+	MaxBump         *string `hcl:"max_bump,optional"`         // Largest upgrade allowed
+	AllowPrerelease bool    `hcl:"allow_prerelease,optional"` // Allow prereleases
+}
+
+// Find returns the configuration file of a directory or of its closest parent that has
+// one, or an empty string when there is none.
+func Find(dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	for {
+		file := filepath.Join(dir, Filename)
+		if _, err := os.Stat(file); err == nil {
+			return file, nil
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return "", fmt.Errorf("failed to read configuration file: %v", err)
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", nil
+		}
+		dir = parent
+	}
+}
+
+// Load reads and validates a configuration file.
+func Load(file string) (*Config, error) {
+	// Parse the file
+	parser := hclparse.NewParser()
+	f, diags := parser.ParseHCLFile(file)
+	if diags.HasErrors() {
+		return nil, fmt.Errorf("failed to parse configuration file: %v", diags)
+	}
+
+	// Decode it into the configuration
+	config := &Config{}
+	if diags := gohcl.DecodeBody(f.Body, nil, config); diags.HasErrors() {
+		return nil, fmt.Errorf("invalid configuration file: %v", diags)
+	}
+	config.Dir = filepath.Dir(file)
+
+	// Validate the values the flags would validate later, to report the file
+	if config.MaxBump != nil {
+		if _, err := semver.ParseBump(*config.MaxBump); err != nil {
+			return nil, fmt.Errorf("invalid max_bump in %s: %v", file, err)
+		}
+	}
+	for _, registry := range config.Registries {
+		for service, value := range registry.Services {
+			if _, err := url.Parse(value); err != nil {
+				return nil, fmt.Errorf("invalid %s service URL of registry %s in %s: %v", service, registry.Host, file, err)
+			}
+		}
+	}
+	if _, err := config.Rules(); err != nil {
+		return nil, fmt.Errorf("invalid dependency block in %s: %v", file, err)
+	}
+
+	return config, nil
+}
+
+// Rules returns the rules of the dependency blocks, in the order of the file.
+func (c *Config) Rules() (Rules, error) {
+	var rules Rules
+	for _, dependency := range c.Dependencies {
+		rule := Rule{Source: dependency.Source, Ignore: dependency.Ignore, AllowPrerelease: dependency.AllowPrerelease}
+		if dependency.Below != nil {
+			below, err := version.NewVersion(*dependency.Below)
+			if err != nil {
+				return nil, fmt.Errorf("%s: invalid below version '%s': %v", dependency.Source, *dependency.Below, err)
+			}
+			rule.Below = below
+		}
+		if dependency.MaxBump != nil {
+			bump, err := semver.ParseBump(*dependency.MaxBump)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", dependency.Source, err)
+			}
+			rule.MaxBump = &bump
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// Paths anchors path patterns of the file to its directory: patterns with a slash are
+// made absolute, others match a name at any depth and are kept as is.
+func (c *Config) Paths(patterns []string) []string {
+	paths := make([]string, 0, len(patterns))
+	for _, pattern := range patterns {
+		if filepath.IsAbs(pattern) || !strings.Contains(strings.TrimSuffix(pattern, "/"), "/") {
+			paths = append(paths, pattern)
+			continue
+		}
+		paths = append(paths, filepath.Join(c.Dir, pattern))
+	}
+	return paths
+}
@@ -0,0 +1,113 @@
+package config
+
+import (
+	"net/url"
+	"path"
+	"strings"
+
+	"tfau/lib/module"
+	"tfau/lib/semver"
+
+	"github.com/hashicorp/go-version"
+)
+
+// Rule overrides the version policy for the dependencies whose source address matches
+// a pattern.
+type Rule struct {
+	Source          string           // Source address pattern (hashicorp/google, terraform-google-modules/*)
+	Ignore          bool             // Never upgrade the dependencies
+	Below           *version.Version // Hold the dependencies below this version
+	MaxBump         *semver.Bump     // Largest upgrade allowed, instead of the policy one
+	AllowPrerelease bool             // Allow prereleases
+}
+
+// Rules are the rules of the dependency blocks, in the order of the file.
+type Rules []Rule
+
+// Policy returns the policy of a dependency: the given policy with every matching rule
+// applied in order. The lowest ceiling and the last bump win.
+func (r Rules) Policy(policy semver.Policy, address string) semver.Policy {
+	for _, rule := range r {
+		if !MatchSource(rule.Source, address) {
+			continue
+		}
+		if rule.Below != nil && (policy.Below == nil || rule.Below.LessThan(policy.Below)) {
+			policy.Below = rule.Below
+		}
+		if rule.MaxBump != nil {
+			policy.MaxBump = *rule.MaxBump
+		}
+		if rule.AllowPrerelease {
+			policy.AllowPrerelease = true
+		}
+	}
+	return policy
+}
+
+// Ignores reports whether a rule excludes a dependency from upgrades.
+func (r Rules) Ignores(address string) bool {
+	for _, rule := range r {
+		if rule.Ignore && MatchSource(rule.Source, address) {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchSource reports whether a source address matches a pattern of a rule. Patterns
+// use the path.Match syntax on each slash-separated segment and match the address or
+// one of its prefixes, so terraform-google-modules/sql-db matches every module of the
+// repository. Git modules are matched by the host and path of their repository
+// (github.com/org/repo). Letter case, the hostname and the tag pattern of Git modules
+// (#pattern) are ignored.
+func MatchSource(pattern string, address string) bool {
+	patterns := strings.Split(strings.ToLower(strings.TrimSuffix(pattern, "/")), "/")
+	segments, hasHost := sourceSegments(address)
+	if matchSegments(patterns, segments) {
+		return true
+	}
+
+	// Addresses may be written with or without their hostname
+	if hasHost && len(segments) > 1 {
+		return matchSegments(patterns, segments[1:])
+	}
+	return false
+}
+
+// sourceSegments splits the address of a dependency into its lowercase segments, and
+// reports whether the first one is a hostname. Git modules are reduced to the host and
+// path of their repository URL.
+func sourceSegments(address string) ([]string, bool) {
+	address, _, _ = strings.Cut(strings.ToLower(address), "#")
+
+	// Only module addresses have a getter (git::https://github.com/org/repo.git)
+	if strings.Contains(address, "::") {
+		if src, err := module.ParseSource(address); err == nil && src.URL != "" {
+			if u, err := url.Parse(src.URL); err == nil && u.Host != "" {
+				segments := []string{u.Hostname()}
+				if repository := strings.TrimSuffix(strings.Trim(u.Path, "/"), ".git"); repository != "" {
+					segments = append(segments, strings.Split(repository, "/")...)
+				}
+				return segments, true
+			}
+		}
+	}
+
+	// Registry addresses have a hostname when their first segment has a dot
+	segments := strings.Split(address, "/")
+	return segments, len(segments) > 2 && strings.Contains(segments[0], ".")
+}
+
+// matchSegments reports whether the segments of a pattern match the first segments of
+// an address.
+func matchSegments(patterns []string, segments []string) bool {
+	if len(patterns) > len(segments) {
+		return false
+	}
+	for i, pattern := range patterns {
+		if matched, _ := path.Match(pattern, segments[i]); !matched {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,81 @@
+package config
+
+import (
+	"testing"
+
+	"tfau/lib/semver"
+
+	"github.com/hashicorp/go-version"
+)
+
+func TestMatchSource(t *testing.T) {
+	tests := []struct {
+		pattern string
+		address string
+		want    bool
+	}{
+		{"hashicorp/google", "hashicorp/google", true},
+		{"hashicorp/google", "hashicorp/google-beta", false},
+		{"hashicorp/*", "hashicorp/google-beta", true},
+		{"HashiCorp/Google", "hashicorp/google", true},
+		{"hashicorp/google", "registry.terraform.io/hashicorp/google", true},
+		{"registry.terraform.io/hashicorp/google", "registry.terraform.io/hashicorp/google", true},
+		{"terraform-google-modules/sql-db", "terraform-google-modules/sql-db/google", true},
+		{"terraform-google-modules/sql-db", "terraform-google-modules/sql-db/google//modules/mysql", true},
+		{"terraform-google-modules/sql-db/", "terraform-google-modules/sql-db/google", true},
+		{"terraform-google-modules/*/google", "app.terraform.io/terraform-google-modules/vpc/google", true},
+		{"terraform", "terraform", true},
+		{"org/repo", "git::https://github.com/org/repo.git", true},
+		{"github.com/org/repo", "git::https://github.com/org/repo.git", true},
+		{"github.com/org/*", "git::https://github.com/org/repo.git", true},
+		{"org/repo", "git::ssh://git@github.com/org/repo.git", true},
+		{"example.com/infra", "git::ssh://git@example.com:2222/infra.git#^network/(.+)$", true},
+		{"github.com/org/repo", "git::git@github.com:org/repo.git", true},
+		{"org/repo", "git::https://github.com/org/repository.git", false},
+		{"gitlab.com/org/repo", "git::https://github.com/org/repo.git", false},
+		{"org", "git::https://github.com/org/repo.git", true},
+	}
+	for _, test := range tests {
+		if got := MatchSource(test.pattern, test.address); got != test.want {
+			t.Errorf("MatchSource(%q, %q) = %v, want %v", test.pattern, test.address, got, test.want)
+		}
+	}
+}
+
+func TestRulesPolicy(t *testing.T) {
+	minor, patch := semver.Minor, semver.Patch
+	rules := Rules{
+		{Source: "hashicorp/*", Below: version.Must(version.NewVersion("7.0")), MaxBump: &minor},
+		{Source: "hashicorp/google", Below: version.Must(version.NewVersion("6.5"))},
+		{Source: "hashicorp/google", Below: version.Must(version.NewVersion("8.0")), MaxBump: &patch},
+		{Source: "org/repo", AllowPrerelease: true},
+		{Source: "hashicorp/aws", Ignore: true},
+	}
+	tests := []struct {
+		address    string
+		bump       semver.Bump
+		below      string
+		prerelease bool
+	}{
+		{"hashicorp/google", semver.Patch, "6.5.0", false},
+		{"hashicorp/google-beta", semver.Minor, "7.0.0", false},
+		{"registry.terraform.io/hashicorp/random", semver.Minor, "7.0.0", false},
+		{"integrations/github", semver.Major, "", false},
+		{"git::https://github.com/org/repo.git", semver.Major, "", true},
+	}
+	for _, test := range tests {
+		got := rules.Policy(semver.Policy{}, test.address)
+		below := ""
+		if got.Below != nil {
+			below = got.Below.String()
+		}
+		if got.MaxBump != test.bump || below != test.below || got.AllowPrerelease != test.prerelease {
+			t.Errorf("Policy(%q) = {%s below=%q prerelease=%v}, want {%s below=%q prerelease=%v}",
+				test.address, got.MaxBump, below, got.AllowPrerelease, test.bump, test.below, test.prerelease)
+		}
+	}
+
+	if !rules.Ignores("registry.terraform.io/hashicorp/aws") || rules.Ignores("hashicorp/google") {
+		t.Errorf("Ignores does not follow the ignore rules")
+	}
+}
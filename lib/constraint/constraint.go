@@ -0,0 +1,192 @@
+package constraint
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/go-version"
+)
+
+// clausePattern splits a single constraint clause into its leading space, operator,
+// space after the operator, optional "v" prefix, version and trailing space.
+var clausePattern = regexp.MustCompile(`^(\s*)(~>|>=|<=|!=|=|>|<)?(\s*)(v?)([0-9][0-9A-Za-z.\-+]*)(\s*)$`)
+
+// Clause is a single comparison of a version constraint, e.g. "~> 6.22.0".
+type Clause struct {
+	Leading   string // Whitespace before the operator
+	Operator  string // Comparison operator, empty for a bare version
+	Spacing   string // Whitespace between the operator and the version
+	Prefix    string // Optional "v" prefix in front of the version
+	Version   string // Version as written by the author
+	Trailing  string // Whitespace after the version
+	Precision int    // Number of dot-separated segments in the version
+}
+
+// Parse splits a constraint string such as ">= 4.0, < 6.0" into its clauses.
+func Parse(constraint string) ([]Clause, error) {
+	var clauses []Clause
+	for _, part := range strings.Split(constraint, ",") {
+		match := clausePattern.FindStringSubmatch(part)
+		if match == nil {
+			return nil, fmt.Errorf("invalid version constraint clause: %q", part)
+		}
+		if _, err := version.NewVersion(match[5]); err != nil {
+			return nil, fmt.Errorf("invalid version in constraint clause %q: %v", part, err)
+		}
+		clauses = append(clauses, Clause{
+			Leading:   match[1],
+			Operator:  match[2],
+			Spacing:   match[3],
+			Prefix:    match[4],
+			Version:   match[5],
+			Trailing:  match[6],
+			Precision: precision(match[5]),
+		})
+	}
+	return clauses, nil
+}
+
+// String renders the clause back with the author's original spacing.
+func (c Clause) String() string {
+	return c.Leading + c.Operator + c.Spacing + c.Prefix + c.Version + c.Trailing
+}
+
+// isLowerBound reports whether the clause pins or raises the minimum version.
+func (c Clause) isLowerBound() bool {
+	switch c.Operator {
+	case "", "=", "~>", ">=":
+		return true
+	}
+	return false
+}
+
+// Rewrite moves the constraint to the latest version while keeping the operators,
+// spacing and precision chosen by the author, e.g. "~>9.1" becomes "~>9.4" for 9.4.0.
+// Upper bounds are only raised when they would exclude the latest version.
+func Rewrite(current string, latest string) (string, error) {
+	latestVersion, err := version.NewVersion(latest)
+	if err != nil {
+		return "", fmt.Errorf("invalid latest version '%s': %v", latest, err)
+	}
+
+	// Without an existing constraint there is no style to preserve
+	if strings.TrimSpace(current) == "" {
+		return latestVersion.String(), nil
+	}
+
+	clauses, err := Parse(current)
+	if err != nil {
+		return "", err
+	}
+
+	parts := make([]string, 0, len(clauses))
+	for _, clause := range clauses {
+		clauseVersion, _ := version.NewVersion(clause.Version)
+
+		switch {
+		case clause.isLowerBound():
+			// Move the bound to the latest version, never downgrading it. Exact pins
+			// are written in full when the precision would pin another version.
+			candidate := format(latestVersion, clause.Precision)
+			candidateVersion, err := version.NewVersion(candidate)
+			if err == nil && (clause.Operator == "" || clause.Operator == "=") && !candidateVersion.Equal(latestVersion) {
+				candidate, candidateVersion = latestVersion.String(), latestVersion
+			}
+			if err == nil && candidateVersion.GreaterThan(clauseVersion) {
+				clause.Version = candidate
+			}
+		case clause.Operator == "<" && !latestVersion.LessThan(clauseVersion):
+			// Raise an exclusive upper bound just past the latest version
+			clause.Version = raiseUpperBound(latestVersion, clauseVersion, clause.Precision)
+		case clause.Operator == "<=" && latestVersion.GreaterThan(clauseVersion):
+			// Raise an inclusive upper bound to the latest version, in full when the
+			// precision would cut it below the latest version (<= 6.2 for 6.2.1)
+			clause.Version = format(latestVersion, clause.Precision)
+			if candidateVersion, err := version.NewVersion(clause.Version); err != nil || candidateVersion.LessThan(latestVersion) {
+				clause.Version = latestVersion.String()
+			}
+		}
+
+		parts = append(parts, clause.String())
+	}
+	rewritten := strings.Join(parts, ",")
+
+	// The rewritten constraint must accept the version it was moved to
+	constraints, err := version.NewConstraint(rewritten)
+	if err != nil {
+		return "", fmt.Errorf("invalid rewritten constraint '%s': %v", rewritten, err)
+	}
+	if !constraints.Check(latestVersion) {
+		return "", fmt.Errorf("rewritten constraint '%s' does not allow version %s", rewritten, latestVersion)
+	}
+	return rewritten, nil
+}
+
+// Baseline returns the version the constraint currently targets, taken from its
+// first lower bound, e.g. 4.0.0 for ">= 4.0, < 6.0".
+func Baseline(constraint string) (*version.Version, error) {
+	clauses, err := Parse(constraint)
+	if err != nil {
+		return nil, err
+	}
+	for _, clause := range clauses {
+		if clause.isLowerBound() || clause.Operator == ">" {
+			return version.NewVersion(clause.Version)
+		}
+	}
+	return nil, fmt.Errorf("version constraint '%s' has no lower bound", constraint)
+}
+
+// precision counts the dot-separated segments of the version core.
+func precision(v string) int {
+	core := strings.SplitN(strings.SplitN(v, "-", 2)[0], "+", 2)[0]
+	return len(strings.Split(core, "."))
+}
+
+// format renders v with the given number of segments. Prerelease and metadata are
+// only kept when the full version is written out.
+func format(v *version.Version, precision int) string {
+	segments := v.Segments()
+	if precision >= len(segments) {
+		return v.String()
+	}
+
+	parts := make([]string, 0, precision)
+	for _, segment := range segments[:precision] {
+		parts = append(parts, strconv.Itoa(segment))
+	}
+	return strings.Join(parts, ".")
+}
+
+// raiseUpperBound computes a new exclusive upper bound above latest that keeps the
+// granularity of the old bound, e.g. "< 6.0" becomes "< 7.0" for 6.2.0.
+func raiseUpperBound(latest *version.Version, bound *version.Version, precision int) string {
+	// Find the most specific non-zero segment of the old bound
+	boundSegments := bound.Segments()
+	position := 0
+	for i := 0; i < precision && i < len(boundSegments); i++ {
+		if boundSegments[i] != 0 {
+			position = i
+		}
+	}
+
+	// Increment the same segment of the latest version and zero the rest
+	latestSegments := latest.Segments()
+	parts := make([]string, 0, precision)
+	for i := 0; i < precision; i++ {
+		segment := 0
+		if i < len(latestSegments) {
+			segment = latestSegments[i]
+		}
+		switch {
+		case i == position:
+			segment++
+		case i > position:
+			segment = 0
+		}
+		parts = append(parts, strconv.Itoa(segment))
+	}
+	return strings.Join(parts, ".")
+}
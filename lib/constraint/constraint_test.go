@@ -0,0 +1,99 @@
+package constraint
+
+import (
+	"testing"
+
+	"github.com/hashicorp/go-version"
+)
+
+func TestRewrite(t *testing.T) {
+	tests := []struct {
+		current string
+		latest  string
+		want    string
+	}{
+		{"", "6.2.1", "6.2.1"},
+		{"~> 5.1", "6.2.1", "~> 6.2"},
+		{"~>9.1", "9.4.0", "~>9.4"},
+		{"~> 6.22.0", "6.31.4", "~> 6.31.4"},
+		{">= 4.0", "6.2.1", ">= 6.2"},
+		{">= 4.0, < 6.0", "6.2.1", ">= 6.2, < 7.0"},
+		{">= 4.0, < 5.1", "6.2.1", ">= 6.2, < 6.3"},
+		{">= 4.0, < 8.0", "6.2.1", ">= 6.2, < 8.0"},
+		{"<= 5.1", "6.2.1", "<= 6.2.1"},
+		{"<= 5.1", "6.2.0", "<= 6.2"},
+		{">= 4.0, <= 5.1", "6.2.1", ">= 6.2, <= 6.2.1"},
+		{"<= 7.0", "6.2.1", "<= 7.0"},
+		{"= 5.1", "6.2.1", "= 6.2.1"},
+		{"5.1", "6.2.0", "6.2"},
+		{"5.1.0", "6.2.1", "6.2.1"},
+		{"v1.2.3", "1.4.0", "v1.4.0"},
+		{"~> 6", "6.2.1", "~> 6"},
+	}
+	for _, test := range tests {
+		got, err := Rewrite(test.current, test.latest)
+		if err != nil {
+			t.Errorf("Rewrite(%q, %q) returned an error: %v", test.current, test.latest, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("Rewrite(%q, %q) = %q, want %q", test.current, test.latest, got, test.want)
+		}
+
+		// The rewritten constraint always accepts the latest version
+		constraints, err := version.NewConstraint(got)
+		if err != nil {
+			t.Errorf("Rewrite(%q, %q) = %q, which does not parse: %v", test.current, test.latest, got, err)
+			continue
+		}
+		if !constraints.Check(version.Must(version.NewVersion(test.latest))) {
+			t.Errorf("Rewrite(%q, %q) = %q, which rejects %s", test.current, test.latest, got, test.latest)
+		}
+	}
+}
+
+func TestRewriteErrors(t *testing.T) {
+	tests := []struct {
+		current string
+		latest  string
+	}{
+		{"~> 5.1", "not-a-version"},
+		{"latest", "6.2.1"},
+		{">= 4.0, != 6.2.1", "6.2.1"},
+		{">= 6.5", "6.2.1"},
+	}
+	for _, test := range tests {
+		if got, err := Rewrite(test.current, test.latest); err == nil {
+			t.Errorf("Rewrite(%q, %q) = %q, want an error", test.current, test.latest, got)
+		}
+	}
+}
+
+func TestBaseline(t *testing.T) {
+	tests := []struct {
+		constraint string
+		want       string
+	}{
+		{"~> 5.1", "5.1.0"},
+		{">= 4.0, < 6.0", "4.0.0"},
+		{"< 6.0, >= 4.2", "4.2.0"},
+		{"> 3.1", "3.1.0"},
+		{"1.2.3", "1.2.3"},
+	}
+	for _, test := range tests {
+		got, err := Baseline(test.constraint)
+		if err != nil {
+			t.Errorf("Baseline(%q) returned an error: %v", test.constraint, err)
+			continue
+		}
+		if got.String() != test.want {
+			t.Errorf("Baseline(%q) = %s, want %s", test.constraint, got, test.want)
+		}
+	}
+
+	for _, constraint := range []string{"< 6.0", "<= 6.0, != 5.0", "main"} {
+		if got, err := Baseline(constraint); err == nil {
+			t.Errorf("Baseline(%q) = %s, want an error", constraint, got)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package diff
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// context is the number of unchanged lines shown around each change.
+const context = 3
+
+// op is a single line of an edit script.
+type op struct {
+	kind byte // ' ' for unchanged, '-' for removed, '+' for added
+	line string
+}
+
+// Unified returns a unified diff between the original and updated contents of a file,
+// or an empty string when they are identical.
+func Unified(filename string, original []byte, updated []byte) string {
+	if string(original) == string(updated) {
+		return ""
+	}
+
+	a := splitLines(string(original))
+	b := splitLines(string(updated))
+	ops := editScript(a, b)
+
+	var sb strings.Builder
+	name := headerPath(filename)
+	fmt.Fprintf(&sb, "--- a/%s\n", name)
+	fmt.Fprintf(&sb, "+++ b/%s\n", name)
+
+	// Walk the edit script and emit one hunk per group of nearby changes
+	for start := 0; start < len(ops); {
+		// Find the next change
+		for start < len(ops) && ops[start].kind == ' ' {
+			start++
+		}
+		if start == len(ops) {
+			break
+		}
+
+		// Extend the hunk while changes are within twice the context of each other
+		first := max(start-context, 0)
+		end := start
+		for i := start; i < len(ops); i++ {
+			if ops[i].kind != ' ' {
+				end = i
+			} else if i-end > 2*context {
+				break
+			}
+		}
+		last := min(end+context+1, len(ops))
+
+		// Compute the line ranges of the hunk in both files
+		oldStart, newStart := 1, 1
+		for _, o := range ops[:first] {
+			if o.kind != '+' {
+				oldStart++
+			}
+			if o.kind != '-' {
+				newStart++
+			}
+		}
+		oldCount, newCount := 0, 0
+		for _, o := range ops[first:last] {
+			if o.kind != '+' {
+				oldCount++
+			}
+			if o.kind != '-' {
+				newCount++
+			}
+		}
+		if oldCount == 0 {
+			oldStart--
+		}
+		if newCount == 0 {
+			newStart--
+		}
+
+		fmt.Fprintf(&sb, "@@ -%d,%d +%d,%d @@\n", oldStart, oldCount, newStart, newCount)
+		for _, o := range ops[first:last] {
+			sb.WriteByte(o.kind)
+			sb.WriteString(o.line)
+			if !strings.HasSuffix(o.line, "\n") {
+				sb.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+
+		start = last
+	}
+
+	return sb.String()
+}
+
+// headerPath returns the path written in the headers of a diff: relative to the working
+// directory with forward slashes, so that git apply and patch -p1 can use the diff.
+// Paths outside the working directory keep their absolute path, without the leading slash.
+func headerPath(filename string) string {
+	if filepath.IsAbs(filename) {
+		if cwd, err := os.Getwd(); err == nil {
+			if rel, err := filepath.Rel(cwd, filename); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+				filename = rel
+			}
+		}
+	}
+	return strings.TrimPrefix(filepath.ToSlash(filepath.Clean(filename)), "/")
+}
+
+// splitLines splits s into lines, keeping the line terminators.
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// editScript computes a minimal line edit script from a to b using the longest
+// common subsequence. The common prefix and suffix are trimmed first, which keeps
+// the table small for the localized edits tfau makes.
+func editScript(a []string, b []string) []op {
+	var prefix, suffix []op
+	for len(a) > 0 && len(b) > 0 && a[0] == b[0] {
+		prefix = append(prefix, op{' ', a[0]})
+		a, b = a[1:], b[1:]
+	}
+	for len(a) > 0 && len(b) > 0 && a[len(a)-1] == b[len(b)-1] {
+		suffix = append([]op{{' ', a[len(a)-1]}}, suffix...)
+		a, b = a[:len(a)-1], b[:len(b)-1]
+	}
+
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	ops := prefix
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			ops = append(ops, op{' ', a[i]})
+			i++
+			j++
+		case j < len(b) && (i == len(a) || lcs[i][j+1] > lcs[i+1][j]):
+			ops = append(ops, op{'+', b[j]})
+			j++
+		default:
+			ops = append(ops, op{'-', a[i]})
+			i++
+		}
+	}
+	return append(ops, suffix...)
+}
@@ -0,0 +1,154 @@
+package diff
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// lines joins lines with a trailing newline each.
+func lines(l ...string) string {
+	return strings.Join(l, "\n") + "\n"
+}
+
+func TestUnified(t *testing.T) {
+	tests := []struct {
+		name     string
+		original string
+		updated  string
+		want     string
+	}{
+		{
+			name:     "identical",
+			original: lines("a", "b"),
+			updated:  lines("a", "b"),
+			want:     "",
+		},
+		{
+			name:     "single change with context",
+			original: lines("1", "2", "3", "4", "5", "6", "7", "8"),
+			updated:  lines("1", "2", "3", "4", "five", "6", "7", "8"),
+			want: lines(
+				"--- a/main.tf",
+				"+++ b/main.tf",
+				"@@ -2,7 +2,7 @@",
+				" 2",
+				" 3",
+				" 4",
+				"-5",
+				"+five",
+				" 6",
+				" 7",
+				" 8",
+			),
+		},
+		{
+			name:     "distant changes in separate hunks",
+			original: lines("1", "2", "3", "4", "5", "6", "7", "8", "9", "10", "11", "12"),
+			updated:  lines("one", "2", "3", "4", "5", "6", "7", "8", "9", "10", "11", "twelve"),
+			want: lines(
+				"--- a/main.tf",
+				"+++ b/main.tf",
+				"@@ -1,4 +1,4 @@",
+				"-1",
+				"+one",
+				" 2",
+				" 3",
+				" 4",
+				"@@ -9,4 +9,4 @@",
+				" 9",
+				" 10",
+				" 11",
+				"-12",
+				"+twelve",
+			),
+		},
+		{
+			name:     "nearby changes in one hunk",
+			original: lines("1", "2", "3", "4", "5", "6"),
+			updated:  lines("one", "2", "3", "4", "5", "six"),
+			want: lines(
+				"--- a/main.tf",
+				"+++ b/main.tf",
+				"@@ -1,6 +1,6 @@",
+				"-1",
+				"+one",
+				" 2",
+				" 3",
+				" 4",
+				" 5",
+				"-6",
+				"+six",
+			),
+		},
+		{
+			name:     "added lines",
+			original: lines("a", "b"),
+			updated:  lines("a", "x", "b"),
+			want: lines(
+				"--- a/main.tf",
+				"+++ b/main.tf",
+				"@@ -1,2 +1,3 @@",
+				" a",
+				"+x",
+				" b",
+			),
+		},
+		{
+			name:     "empty original",
+			original: "",
+			updated:  lines("a"),
+			want: lines(
+				"--- a/main.tf",
+				"+++ b/main.tf",
+				"@@ -0,0 +1,1 @@",
+				"+a",
+			),
+		},
+		{
+			name:     "no newline at end of file",
+			original: "a\nb",
+			updated:  "a\nc",
+			want: lines(
+				"--- a/main.tf",
+				"+++ b/main.tf",
+				"@@ -1,2 +1,2 @@",
+				" a",
+				"-b",
+				`\ No newline at end of file`,
+				"+c",
+				`\ No newline at end of file`,
+			),
+		},
+	}
+	for _, test := range tests {
+		got := Unified("main.tf", []byte(test.original), []byte(test.updated))
+		if got != test.want {
+			t.Errorf("%s: Unified() =\n%s\nwant\n%s", test.name, got, test.want)
+		}
+	}
+}
+
+func TestUnifiedHeaders(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		filename string
+		want     string
+	}{
+		{"main.tf", "main.tf"},
+		{"./envs/prod/main.tf", "envs/prod/main.tf"},
+		{filepath.Join(cwd, "envs", "prod", "main.tf"), "envs/prod/main.tf"},
+		{filepath.Join(filepath.Dir(cwd), "other", "main.tf"), strings.TrimPrefix(filepath.ToSlash(filepath.Join(filepath.Dir(cwd), "other", "main.tf")), "/")},
+	}
+	for _, test := range tests {
+		got := Unified(test.filename, []byte("a\n"), []byte("b\n"))
+		want := lines("--- a/"+test.want, "+++ b/"+test.want, "@@ -1,1 +1,1 @@", "-a", "+b")
+		if got != want {
+			t.Errorf("Unified(%q) =\n%s\nwant\n%s", test.filename, got, want)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package hcl
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+)
+
+// Document is a .tf file loaded once and shared by every upgrader. The schema content
+// is used to extract the current versions, and all edits go to the single hclwrite
+// file, which is written back at most once.
+type Document struct {
+	Filename string
+	Mode     os.FileMode      // Permissions of the original file, kept on write
+	Original []byte           // Content as read from disk
+	Content  *hcl.BodyContent // Parsed content based on the schema
+	File     *hclwrite.File   // In-memory document edited by the upgraders
+}
+
+// Load reads and parses a .tf file.
+func Load(filename string) (*Document, error) {
+	info, err := os.Stat(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat file: %v", err)
+	}
+
+	// Read the file content once
+	src, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %v", err)
+	}
+
+	// Extract the content based on the schema
+	content, err := Parse(src, filename)
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse the same bytes into the editable document
+	file, diags := hclwrite.ParseConfig(src, filename, hcl.Pos{Line: 1, Column: 1})
+	if diags.HasErrors() {
+		return nil, diagnosticsToError(diags)
+	}
+
+	return &Document{
+		Filename: filename,
+		Mode:     info.Mode().Perm(),
+		Original: src,
+		Content:  content,
+		File:     file,
+	}, nil
+}
+
+// Bytes returns the current content of the document, including all edits.
+func (d *Document) Bytes() []byte {
+	return d.File.Bytes()
+}
+
+// Changed reports whether the edits changed the content of the document. hclwrite
+// formats the whole file on output, so formatting-only differences do not count.
+func (d *Document) Changed() bool {
+	return string(d.Bytes()) != string(hclwrite.Format(d.Original))
+}
+
+// Save atomically replaces the file with the edited document. The content is written
+// to a temporary file in the same directory, which is then renamed over the original,
+// so the file is never left half-written.
+func (d *Document) Save() error {
+	dir, base := filepath.Split(d.Filename)
+	if dir == "" {
+		dir = "."
+	}
+
+	tmp, err := os.CreateTemp(dir, "."+base+".tfau-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %v", err)
+	}
+	defer os.Remove(tmp.Name()) // No-op once renamed
+
+	if _, err := tmp.Write(d.Bytes()); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write temporary file: %v", err)
+	}
+	if err := tmp.Chmod(d.Mode); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to set file permissions: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close temporary file: %v", err)
+	}
+
+	if err := os.Rename(tmp.Name(), d.Filename); err != nil {
+		return fmt.Errorf("failed to replace file: %v", err)
+	}
+	return nil
+}
@@ -26,16 +26,24 @@ var Schema = &hcl.BodySchema{
 			Type:       "data",
 			LabelNames: []string{"type", "name"},
 		},
+		{
+			Type:       "resource",
+			LabelNames: []string{"type", "name"},
+		},
+		{
+			Type:       "ephemeral",
+			LabelNames: []string{"type", "name"},
+		},
 	},
 }
 
-// ParseFile parses a .tf file and returns the parsed content.
-func ParseFile(filename string) (*hcl.BodyContent, error) {
+// Parse parses the source of a .tf file and returns the parsed content.
+func Parse(src []byte, filename string) (*hcl.BodyContent, error) {
 	// Create a new HCL parser
 	parser := hclparse.NewParser()
 
 	// Parse the .tf file
-	file, diags := parser.ParseHCLFile(filename)
+	file, diags := parser.ParseHCL(src, filename)
 	if diags.HasErrors() {
 		// Filter out "unsupported block type" errors
 		diags = filterUnsupportedBlockErrors(diags)
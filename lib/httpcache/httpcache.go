@@ -0,0 +1,269 @@
+package httpcache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Cache is an on-disk cache for GET requests to the registry and release APIs.
+// Fresh entries are served without a request; stale entries are revalidated with
+// ETag / If-Modified-Since.
+type Cache struct {
+	Dir     string        // Cache directory, caching is disabled when empty
+	TTL     time.Duration // How long an entry is served without revalidation
+	Refresh bool          // Ignore cached entries, but still store fresh responses
+	Offline bool          // Never make a request, serve cached entries of any age
+	Client  *http.Client
+
+	// Token returns the bearer token sent to a host, or an empty string for none
+	Token func(host string) string
+}
+
+// Timeout bounds connecting to a host and waiting for its response headers, so that an
+// unresponsive host fails instead of hanging the run. Reading the body is not bounded:
+// provider packages may take long to download on a slow link.
+const Timeout = 30 * time.Second
+
+// Default is the cache used by the package-level functions, configured by the CLI.
+var Default = &Cache{
+	Dir:    DefaultDir(),
+	TTL:    time.Hour,
+	Client: &http.Client{Transport: newTransport()},
+}
+
+// newTransport returns the default transport with the connection and response header
+// timeouts set.
+func newTransport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{Timeout: Timeout, KeepAlive: 30 * time.Second}).DialContext
+	transport.TLSHandshakeTimeout = Timeout
+	transport.ResponseHeaderTimeout = Timeout
+	return transport
+}
+
+// entry is a cached response stored as JSON.
+type entry struct {
+	URL          string    `json:"url"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+	Fetched      time.Time `json:"fetched"`
+	Body         []byte    `json:"body"`
+}
+
+// StatusError is returned when the server answers with an unexpected status.
+type StatusError struct {
+	URL        string
+	StatusCode int
+	Status     string
+}
+
+// Error describes the failed request.
+func (e *StatusError) Error() string {
+	if e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden {
+		return fmt.Sprintf("%s returned %s (check the credentials configured for the host)", e.URL, e.Status)
+	}
+	return fmt.Sprintf("%s returned %s", e.URL, e.Status)
+}
+
+// DefaultDir returns the tfau directory in the user cache directory
+// ($XDG_CACHE_HOME on Linux), or an empty string when there is none.
+func DefaultDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "tfau")
+}
+
+// Get fetches a URL through the default cache.
+func Get(url string) ([]byte, error) {
+	return Default.Get(url)
+}
+
+// Get returns the body of a successful GET request to url, from the cache when the
+// entry is fresh enough.
+func (c *Cache) Get(url string) ([]byte, error) {
+	cached := c.load(url)
+
+	// Offline, the cache is the only source regardless of the age of the entry
+	if c.Offline {
+		if cached == nil {
+			return nil, fmt.Errorf("%s is not in the cache (offline mode)", url)
+		}
+		log.Printf("Using cached response for %s (offline mode)", url)
+		return cached.Body, nil
+	}
+
+	// Serve fresh entries without any request
+	if cached != nil && !c.Refresh && time.Since(cached.Fetched) < c.TTL {
+		log.Printf("Using cached response for %s", url)
+		return cached.Body, nil
+	}
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Authenticate with the credentials configured for the host
+	if c.Token != nil {
+		if token := c.Token(req.URL.Hostname()); token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+	}
+
+	// Revalidate stale entries instead of downloading them again
+	if cached != nil && !c.Refresh {
+		if cached.ETag != "" {
+			req.Header.Set("If-None-Match", cached.ETag)
+		}
+		if cached.LastModified != "" {
+			req.Header.Set("If-Modified-Since", cached.LastModified)
+		}
+	}
+
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		// Fall back to the stale entry when the server cannot be reached
+		if cached != nil {
+			log.Printf("Warning: Using stale cached response for %s: %v", url, err)
+			return cached.Body, nil
+		}
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified && cached != nil:
+		log.Printf("Cached response for %s is still valid", url)
+		cached.Fetched = time.Now()
+		c.store(cached)
+		return cached.Body, nil
+	case resp.StatusCode != http.StatusOK:
+		return nil, &StatusError{URL: url, StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %v", err)
+	}
+
+	c.store(&entry{
+		URL:          url,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		Fetched:      time.Now(),
+		Body:         body,
+	})
+	return body, nil
+}
+
+// Download downloads a URL with the client of the default cache.
+func Download(url string, w io.Writer) error {
+	return Default.Download(url, w)
+}
+
+// Download streams the body of a successful GET request to url into w, bypassing
+// the cache. It is meant for large files such as provider packages.
+func (c *Cache) Download(url string, w io.Writer) error {
+	if c.Offline {
+		return fmt.Errorf("%s cannot be downloaded in offline mode", url)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+
+	// Authenticate with the credentials configured for the host
+	if c.Token != nil {
+		if token := c.Token(req.URL.Hostname()); token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+	}
+
+	log.Printf("Downloading %s", url)
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return &StatusError{URL: url, StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		return fmt.Errorf("failed to download %s: %v", url, err)
+	}
+	return nil
+}
+
+// path returns the file an entry for url is stored in.
+func (c *Cache) path(url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return filepath.Join(c.Dir, hex.EncodeToString(sum[:])+".json")
+}
+
+// load reads the cached entry for url, if any.
+func (c *Cache) load(url string) *entry {
+	if c.Dir == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(c.path(url))
+	if err != nil {
+		return nil
+	}
+
+	var cached entry
+	if err := json.Unmarshal(data, &cached); err != nil || cached.URL != url {
+		log.Printf("Warning: Ignoring corrupt cache entry for %s", url)
+		return nil
+	}
+	return &cached
+}
+
+// store writes an entry to the cache. Failures only disable caching for the entry.
+func (c *Cache) store(cached *entry) {
+	if c.Dir == "" {
+		return
+	}
+
+	data, err := json.Marshal(cached)
+	if err != nil {
+		return
+	}
+
+	if err := os.MkdirAll(c.Dir, 0755); err != nil {
+		log.Printf("Warning: Failed to create cache directory %s: %v", c.Dir, err)
+		return
+	}
+
+	// Write through a temporary file so concurrent runs never read a partial entry
+	tmp, err := os.CreateTemp(c.Dir, ".entry-*")
+	if err != nil {
+		log.Printf("Warning: Failed to write cache entry for %s: %v", cached.URL, err)
+		return
+	}
+	defer os.Remove(tmp.Name()) // No-op once renamed
+
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), c.path(cached.URL))
+	}
+	if err != nil {
+		log.Printf("Warning: Failed to write cache entry for %s: %v", cached.URL, err)
+	}
+}
@@ -0,0 +1,94 @@
+package index
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/hashicorp/go-version"
+)
+
+// Index is a snapshot of the versions available for each module, provider and
+// Terraform itself. It is produced on a connected host with `tfau index export`
+// and lets tfau resolve versions without network access.
+type Index struct {
+	Distribution string                       `json:"distribution,omitempty"` // Distribution the index was exported for (terraform or opentofu)
+	Registry     string                       `json:"registry,omitempty"`     // Registry of the sources without a hostname
+	Modules      map[string][]string          `json:"modules"`                // Module address -> versions
+	Providers    map[string][]string          `json:"providers"`              // Provider source -> versions
+	Terraform    []string                     `json:"terraform"`              // Terraform versions
+	Commits      map[string]map[string]string `json:"commits,omitempty"`      // Git module address -> tag -> commit
+}
+
+// New returns an empty index.
+func New() *Index {
+	return &Index{
+		Modules:   make(map[string][]string),
+		Providers: make(map[string][]string),
+		Commits:   make(map[string]map[string]string),
+	}
+}
+
+// Load reads an index file.
+func Load(filename string) (*Index, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read index file: %v", err)
+	}
+
+	idx := New()
+	if err := json.Unmarshal(data, idx); err != nil {
+		return nil, fmt.Errorf("failed to parse index file %s: %v", filename, err)
+	}
+	return idx, nil
+}
+
+// Check reports an error when the index was exported for another distribution or
+// default registry than the current one: hostless addresses and the "terraform" key
+// would otherwise resolve to the versions of the other distribution. Indexes exported
+// before these fields existed are accepted.
+func (i *Index) Check(distribution string, registry string) error {
+	if i.Distribution != "" && i.Distribution != distribution {
+		return fmt.Errorf("index was exported for %s, not %s (export it again with the same --tofu setting)", i.Distribution, distribution)
+	}
+	if i.Registry != "" && i.Registry != registry {
+		return fmt.Errorf("index was exported for the registry %s, not %s", i.Registry, registry)
+	}
+	return nil
+}
+
+// Marshal encodes the index as indented JSON.
+func (i *Index) Marshal() ([]byte, error) {
+	data, err := json.MarshalIndent(i, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode index: %v", err)
+	}
+	return append(data, '\n'), nil
+}
+
+// Strings converts versions to their original strings, newest first.
+func Strings(versions []*version.Version) []string {
+	sorted := make([]*version.Version, len(versions))
+	copy(sorted, versions)
+	sort.Sort(sort.Reverse(version.Collection(sorted)))
+
+	list := make([]string, 0, len(sorted))
+	for _, v := range sorted {
+		list = append(list, v.Original())
+	}
+	return list
+}
+
+// Parse converts a list of versions from the index.
+func Parse(list []string) ([]*version.Version, error) {
+	versions := make([]*version.Version, 0, len(list))
+	for _, s := range list {
+		v, err := version.NewVersion(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid version '%s' in index: %v", s, err)
+		}
+		versions = append(versions, v)
+	}
+	return versions, nil
+}
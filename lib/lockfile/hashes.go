@@ -0,0 +1,143 @@
+package lockfile
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+
+	"tfau/lib/httpcache"
+	"tfau/lib/provider"
+
+	"github.com/ProtonMail/go-crypto/openpgp" // SHASUMS signature verification
+	"golang.org/x/mod/sumdb/dirhash"          // h1: package hashes
+)
+
+// Hashes returns the hashes of a provider version to record in a lock file, the way
+// terraform init does: a zh: hash for every package listed in the signed SHASUMS
+// document of the release, and an h1: hash of the content of the package of each
+// platform (<os>_<arch>), which requires downloading it.
+func Hashes(source string, providerVersion string, platforms []string) ([]string, error) {
+	if len(platforms) == 0 {
+		return nil, fmt.Errorf("no platform to lock provider '%s' for", source)
+	}
+
+	// Fetch the package metadata of every platform
+	var packages []*provider.Package
+	for _, platform := range platforms {
+		pkg, err := provider.GetPackage(source, providerVersion, platform)
+		if err != nil {
+			return nil, err
+		}
+		packages = append(packages, pkg)
+	}
+
+	// Every platform shares the SHASUMS document of the release
+	sums, err := fetchSHASums(packages[0])
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify provider '%s' %s: %v", source, providerVersion, err)
+	}
+
+	var hashes []string
+	for filename, sum := range sums {
+		if strings.HasSuffix(filename, ".zip") {
+			hashes = append(hashes, "zh:"+sum)
+		}
+	}
+
+	// Hash the content of the package of each platform
+	for _, pkg := range packages {
+		if sum, ok := sums[pkg.Filename]; !ok || sum != pkg.SHASum {
+			return nil, fmt.Errorf("package %s of provider '%s' does not match the SHASUMS document", pkg.Filename, source)
+		}
+		hash, err := packageHash(pkg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to hash package %s of provider '%s': %v", pkg.Filename, source, err)
+		}
+		hashes = append(hashes, hash)
+	}
+
+	// Lock files list the hashes sorted, h1: before zh:
+	sort.Strings(hashes)
+	return hashes, nil
+}
+
+// fetchSHASums fetches the SHASUMS document of a release, checks its signature with
+// the signing keys advertised by the registry and returns the checksum of each file.
+func fetchSHASums(pkg *provider.Package) (map[string]string, error) {
+	document, err := httpcache.Get(pkg.SHASumsURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch SHASUMS: %v", err)
+	}
+	if pkg.SHASumsSignatureURL == "" {
+		return nil, fmt.Errorf("the registry advertises no SHASUMS signature")
+	}
+	signature, err := httpcache.Get(pkg.SHASumsSignatureURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch SHASUMS signature: %v", err)
+	}
+
+	// Check the signature against the keys of the provider
+	var keyring openpgp.EntityList
+	for _, key := range pkg.SigningKeys.GPGPublicKeys {
+		entities, err := openpgp.ReadArmoredKeyRing(strings.NewReader(key.ASCIIArmor))
+		if err != nil {
+			return nil, fmt.Errorf("invalid signing key %s: %v", key.KeyID, err)
+		}
+		keyring = append(keyring, entities...)
+	}
+	if len(keyring) == 0 {
+		return nil, fmt.Errorf("the registry advertises no signing key")
+	}
+	if _, err := openpgp.CheckDetachedSignature(keyring, bytes.NewReader(document), bytes.NewReader(signature), nil); err != nil {
+		return nil, fmt.Errorf("invalid SHASUMS signature: %v", err)
+	}
+
+	// Parse the "<sha256>  <filename>" lines
+	sums := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(document))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		sums[fields[1]] = strings.ToLower(fields[0])
+	}
+	return sums, nil
+}
+
+// packageHash downloads the package of a platform, checks its checksum and returns
+// its h1: hash, computed over the files of the archive.
+func packageHash(pkg *provider.Package) (string, error) {
+	tmp, err := os.CreateTemp("", "tfau-provider-*.zip")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary file: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	// Download the archive, computing its checksum on the way
+	checksum := sha256.New()
+	err = httpcache.Download(pkg.DownloadURL, io.MultiWriter(tmp, checksum))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", err
+	}
+	if sum := hex.EncodeToString(checksum.Sum(nil)); sum != strings.ToLower(pkg.SHASum) {
+		return "", fmt.Errorf("checksum mismatch: got %s, expected %s", sum, pkg.SHASum)
+	}
+
+	hash, err := dirhash.HashZip(tmp.Name(), dirhash.Hash1)
+	if err != nil {
+		return "", err
+	}
+	log.Printf("Hashed package %s: %s", pkg.Filename, hash)
+	return hash, nil
+}
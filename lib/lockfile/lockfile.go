@@ -0,0 +1,168 @@
+package lockfile
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"tfau/lib/constraint"
+	"tfau/lib/hcl"
+
+	"github.com/hashicorp/go-version"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// Filename is the name of the dependency lock file of a root module.
+const Filename = ".terraform.lock.hcl"
+
+// Provider is a provider entry of a dependency lock file.
+type Provider struct {
+	Address     string   // Fully qualified address, e.g. registry.terraform.io/hashicorp/aws
+	Version     string   // Selected version
+	Constraints string   // Version constraints of the configuration, empty when none
+	Hashes      []string // Package hashes (h1:, zh:)
+}
+
+// Load reads the dependency lock file of a directory. It returns nil without an error
+// when the directory has none.
+func Load(dir string) (*hcl.Document, error) {
+	path := filepath.Join(dir, Filename)
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	return hcl.Load(path)
+}
+
+// Providers extracts the provider entries of a lock file, sorted by address.
+func Providers(doc *hcl.Document) ([]Provider, error) {
+	var providers []Provider
+	for _, block := range doc.Content.Blocks {
+		if block.Type != "provider" {
+			continue
+		}
+		entry := Provider{Address: strings.ToLower(block.Labels[0])}
+
+		// Decode the attributes of the provider block
+		attrs, diags := block.Body.JustAttributes()
+		if diags.HasErrors() {
+			return nil, fmt.Errorf("failed to decode attributes for provider '%s': %s", entry.Address, diags)
+		}
+
+		for name, attr := range attrs {
+			value, diags := attr.Expr.Value(nil)
+			if diags.HasErrors() {
+				return nil, fmt.Errorf("failed to evaluate '%s' expression for provider '%s': %s", name, entry.Address, diags)
+			}
+
+			switch name {
+			case "version", "constraints":
+				if value.Type() != cty.String || value.IsNull() {
+					return nil, fmt.Errorf("'%s' of provider '%s' is not a string", name, entry.Address)
+				}
+				if name == "version" {
+					entry.Version = value.AsString()
+				} else {
+					entry.Constraints = value.AsString()
+				}
+			case "hashes":
+				if !value.CanIterateElements() || value.IsNull() {
+					return nil, fmt.Errorf("'hashes' of provider '%s' is not a list", entry.Address)
+				}
+				for _, hash := range value.AsValueSlice() {
+					if hash.Type() != cty.String || hash.IsNull() {
+						return nil, fmt.Errorf("'hashes' of provider '%s' is not a list of strings", entry.Address)
+					}
+					entry.Hashes = append(entry.Hashes, hash.AsString())
+				}
+			}
+		}
+
+		providers = append(providers, entry)
+	}
+
+	sort.Slice(providers, func(i, j int) bool {
+		return providers[i].Address < providers[j].Address
+	})
+	return providers, nil
+}
+
+// Constraints merges the version constraints of a provider in every module of a root
+// module tree into the constraints string of its lock entry, like terraform init: each
+// clause once, written as "operator version" and sorted by version, then by operator.
+func Constraints(constraints []string) (string, error) {
+	var clauses []constraint.Clause
+	seen := make(map[string]bool)
+	for _, value := range constraints {
+		parsed, err := constraint.Parse(value)
+		if err != nil {
+			return "", err
+		}
+		for _, clause := range parsed {
+			key := clause.Operator + " " + clause.Version
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			clauses = append(clauses, clause)
+		}
+	}
+
+	sort.SliceStable(clauses, func(i, j int) bool {
+		a, _ := version.NewVersion(clauses[i].Version)
+		b, _ := version.NewVersion(clauses[j].Version)
+		if !a.Equal(b) {
+			return a.LessThan(b)
+		}
+		return clauses[i].Operator < clauses[j].Operator
+	})
+
+	parts := make([]string, len(clauses))
+	for i, clause := range clauses {
+		parts[i] = strings.TrimSpace(clause.Operator + " " + clause.Version)
+	}
+	return strings.Join(parts, ", "), nil
+}
+
+// SetProvider rewrites the version, constraints and hashes of the entry of a provider
+// in the in-memory lock file, keeping the attribute order terraform init writes. It
+// reports whether the lock file has an entry for the provider.
+func SetProvider(file *hclwrite.File, entry Provider) bool {
+	for _, block := range file.Body().Blocks() {
+		if block.Type() != "provider" || len(block.Labels()) == 0 || !strings.EqualFold(block.Labels()[0], entry.Address) {
+			continue
+		}
+
+		body := block.Body()
+		body.SetAttributeValue("version", cty.StringVal(entry.Version))
+		if entry.Constraints != "" {
+			body.SetAttributeValue("constraints", cty.StringVal(entry.Constraints))
+		} else {
+			body.RemoveAttribute("constraints")
+		}
+		body.SetAttributeRaw("hashes", hashTokens(entry.Hashes))
+		return true
+	}
+	return false
+}
+
+// hashTokens renders a list of hashes with one hash per line and a trailing comma,
+// like terraform init.
+func hashTokens(hashes []string) hclwrite.Tokens {
+	tokens := hclwrite.Tokens{
+		{Type: hclsyntax.TokenOBrack, Bytes: []byte("[")},
+		{Type: hclsyntax.TokenNewline, Bytes: []byte("\n")},
+	}
+	for _, hash := range hashes {
+		tokens = append(tokens, hclwrite.TokensForValue(cty.StringVal(hash))...)
+		tokens = append(tokens,
+			&hclwrite.Token{Type: hclsyntax.TokenComma, Bytes: []byte(",")},
+			&hclwrite.Token{Type: hclsyntax.TokenNewline, Bytes: []byte("\n")},
+		)
+	}
+	return append(tokens, &hclwrite.Token{Type: hclsyntax.TokenCBrack, Bytes: []byte("]")})
+}
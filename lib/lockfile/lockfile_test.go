@@ -0,0 +1,30 @@
+package lockfile
+
+import "testing"
+
+func TestConstraints(t *testing.T) {
+	tests := []struct {
+		constraints []string
+		want        string
+	}{
+		{nil, ""},
+		{[]string{"~> 5.0"}, "~> 5.0"},
+		{[]string{"~>5.0", "~> 5.0"}, "~> 5.0"},
+		{[]string{">= 4.0, < 6.0", "~> 5.31"}, ">= 4.0, ~> 5.31, < 6.0"},
+		{[]string{"v3.2.0", ">=3.0"}, ">= 3.0, 3.2.0"},
+	}
+	for _, tt := range tests {
+		got, err := Constraints(tt.constraints)
+		if err != nil {
+			t.Errorf("Constraints(%q) error: %v", tt.constraints, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Constraints(%q) = %q, want %q", tt.constraints, got, tt.want)
+		}
+	}
+
+	if _, err := Constraints([]string{"~> five"}); err == nil {
+		t.Error("Constraints with an invalid clause did not fail")
+	}
+}
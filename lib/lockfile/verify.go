@@ -0,0 +1,144 @@
+package lockfile
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"tfau/lib/provider"
+
+	"github.com/hashicorp/go-version"
+)
+
+// ProblemKind is the kind of disagreement between a lock file and its configuration.
+type ProblemKind string
+
+const (
+	ProblemUnsatisfied ProblemKind = "unsatisfied" // The locked version is outside a constraint
+	ProblemMissing     ProblemKind = "missing"     // A required or used provider is not locked
+	ProblemStale       ProblemKind = "stale"       // A locked provider is no longer used
+	ProblemHashes      ProblemKind = "hashes"      // No hash of the package of a platform
+	ProblemLookup      ProblemKind = "lookup"      // The package of a platform could not be looked up
+)
+
+// Problem is a disagreement between a lock file and the configuration of its root module.
+type Problem struct {
+	Address    string      // Fully qualified provider address
+	Kind       ProblemKind // What is wrong
+	Constraint string      // Constraint involved, if any
+	Detail     string      // Human readable description
+}
+
+// Config is the provider side of the configuration of a root module, including its
+// child modules.
+type Config struct {
+	Requirements []provider.Requirement // Version constraints, from provider.Extract
+	Used         []string               // Sources of every provider used, from provider.Used
+	Complete     bool                   // Whether every child module could be inspected
+}
+
+// Verify compares the entries of a lock file with the configuration of its root module:
+// every provider with a constraint must be locked to a version that satisfies all its
+// constraints, every provider used must be locked, every locked provider must still be
+// used, and every locked version must have a hash for the package of each platform
+// (<os>_<arch>). Stale entries are only reported when the configuration is complete,
+// since a child module that could not be inspected may use them.
+func Verify(locked []Provider, config Config, platforms []string) []Problem {
+	entries := make(map[string]Provider, len(locked))
+	for _, entry := range locked {
+		entries[entry.Address] = entry
+	}
+
+	var problems []Problem
+
+	// Every constraint must be satisfied by the locked version
+	reported := make(map[string]bool)
+	for _, requirement := range config.Requirements {
+		address, err := provider.Address(requirement.Source)
+		if err != nil {
+			continue
+		}
+		entry, exists := entries[address]
+		if !exists {
+			if !reported[address] {
+				problems = append(problems, Problem{Address: address, Kind: ProblemMissing, Constraint: requirement.Version,
+					Detail: fmt.Sprintf("%s is required (%s) but not locked", address, requirement.Version)})
+				reported[address] = true
+			}
+			continue
+		}
+		if ok, err := satisfies(entry.Version, requirement.Version); err != nil || !ok {
+			detail := fmt.Sprintf("locked version %s does not satisfy %s", entry.Version, requirement.Version)
+			if err != nil {
+				detail = fmt.Sprintf("cannot check locked version %s against %s: %v", entry.Version, requirement.Version, err)
+			}
+			problems = append(problems, Problem{Address: address, Kind: ProblemUnsatisfied, Constraint: requirement.Version, Detail: detail})
+		}
+	}
+
+	// Every provider used must be locked, with or without a constraint
+	for _, source := range config.Used {
+		address, err := provider.Address(source)
+		if err != nil || reported[address] {
+			continue
+		}
+		if _, exists := entries[address]; !exists {
+			problems = append(problems, Problem{Address: address, Kind: ProblemMissing,
+				Detail: fmt.Sprintf("%s is used but not locked", address)})
+			reported[address] = true
+		}
+	}
+
+	// Every locked provider must still be used
+	if config.Complete {
+		used := make(map[string]bool)
+		for _, source := range config.Used {
+			if address, err := provider.Address(source); err == nil {
+				used[address] = true
+			}
+		}
+		for _, entry := range locked {
+			if !used[entry.Address] {
+				problems = append(problems, Problem{Address: entry.Address, Kind: ProblemStale,
+					Detail: fmt.Sprintf("%s is locked but no longer used", entry.Address)})
+			}
+		}
+	}
+
+	// Every locked version must have a hash of the package of each platform
+	for _, entry := range locked {
+		hashes := make(map[string]bool, len(entry.Hashes))
+		for _, hash := range entry.Hashes {
+			hashes[hash] = true
+		}
+		for _, platform := range platforms {
+			pkg, err := provider.GetPackage(entry.Address, entry.Version, platform)
+			if err != nil {
+				problems = append(problems, Problem{Address: entry.Address, Kind: ProblemLookup, Detail: err.Error()})
+				continue
+			}
+			if !hashes["zh:"+strings.ToLower(pkg.SHASum)] {
+				problems = append(problems, Problem{Address: entry.Address, Kind: ProblemHashes,
+					Detail: fmt.Sprintf("no hash of the %s package of %s %s", platform, entry.Address, entry.Version)})
+			}
+		}
+	}
+
+	sort.SliceStable(problems, func(i, j int) bool {
+		return problems[i].Address < problems[j].Address
+	})
+	return problems
+}
+
+// satisfies reports whether a version satisfies a version constraint.
+func satisfies(lockedVersion string, constraint string) (bool, error) {
+	v, err := version.NewVersion(lockedVersion)
+	if err != nil {
+		return false, err
+	}
+	constraints, err := version.NewConstraint(constraint)
+	if err != nil {
+		return false, err
+	}
+	return constraints.Check(v), nil
+}
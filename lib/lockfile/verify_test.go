@@ -0,0 +1,46 @@
+package lockfile
+
+import (
+	"testing"
+
+	"tfau/lib/provider"
+)
+
+func TestVerify(t *testing.T) {
+	locked := []Provider{
+		{Address: "registry.terraform.io/hashicorp/google", Version: "5.20.0"},
+		{Address: "registry.terraform.io/hashicorp/null", Version: "3.2.0"},
+	}
+	config := Config{
+		Requirements: []provider.Requirement{
+			{Source: "hashicorp/google", Version: "~> 5.31"},
+			{Source: "hashicorp/aws", Version: "~> 5.0"},
+		},
+		Used:     []string{"hashicorp/google", "hashicorp/aws", "hashicorp/random"},
+		Complete: true,
+	}
+
+	want := map[string]ProblemKind{
+		"registry.terraform.io/hashicorp/aws":    ProblemMissing,
+		"registry.terraform.io/hashicorp/google": ProblemUnsatisfied,
+		"registry.terraform.io/hashicorp/null":   ProblemStale,
+		"registry.terraform.io/hashicorp/random": ProblemMissing,
+	}
+	problems := Verify(locked, config, nil)
+	if len(problems) != len(want) {
+		t.Errorf("Verify returned %d problems, want %d: %+v", len(problems), len(want), problems)
+	}
+	for _, problem := range problems {
+		if want[problem.Address] != problem.Kind {
+			t.Errorf("Verify reported %s for %s, want %s", problem.Kind, problem.Address, want[problem.Address])
+		}
+	}
+
+	// Stale entries are not reported when a child module could not be inspected
+	config.Complete = false
+	for _, problem := range Verify(locked, config, nil) {
+		if problem.Kind == ProblemStale {
+			t.Errorf("Verify reported a stale entry for %s with an incomplete configuration", problem.Address)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package module
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"tfau/lib/httpcache"
+
+	"github.com/hashicorp/go-version"
+)
+
+// commitPattern matches a full Git commit SHA (SHA-1 or SHA-256).
+var commitPattern = regexp.MustCompile(`^(?:[0-9a-f]{40}|[0-9a-f]{64})$`)
+
+var (
+	tagCommitsMu sync.Mutex
+	tagCommits   = make(map[string]map[string]string) // Repository URL -> tag -> commit
+)
+
+// IsCommitSHA reports whether a Git ref is a full commit SHA, as used to pin modules.
+func IsCommitSHA(ref string) bool {
+	return commitPattern.MatchString(ref)
+}
+
+// storeTagCommits remembers the commits of the tags of a repository.
+func storeTagCommits(url string, tags map[string]string) {
+	tagCommitsMu.Lock()
+	defer tagCommitsMu.Unlock()
+	tagCommits[url] = tags
+}
+
+// TagCommits returns the commits of the tags of a Git module address fetched so far,
+// or nil when the tags of its repository are unknown. Indexes record them so that
+// modules pinned to a commit can be resolved offline.
+func TagCommits(address string) map[string]string {
+	source, _ := splitTaggedAddress(address)
+	src, err := ParseSource(source)
+	if err != nil || src.Type != SourceGit {
+		return nil
+	}
+
+	tagCommitsMu.Lock()
+	defer tagCommitsMu.Unlock()
+	return tagCommits[src.URL]
+}
+
+// StoreTagCommits records the commits of the tags of a Git module address, as read
+// from an index.
+func StoreTagCommits(address string, tags map[string]string) error {
+	source, _ := splitTaggedAddress(address)
+	src, err := ParseSource(source)
+	if err != nil {
+		return err
+	}
+	if src.Type != SourceGit {
+		return fmt.Errorf("%s module sources have no commits: %s", src.Type, address)
+	}
+	storeTagCommits(src.URL, tags)
+	return nil
+}
+
+// repositoryTags returns the tags of the repository of a Git module source with their
+// commits, fetching them unless already known.
+func repositoryTags(source string) (map[string]string, error) {
+	src, err := ParseSource(source)
+	if err != nil {
+		return nil, err
+	}
+	if src.Type != SourceGit {
+		return nil, fmt.Errorf("%s module sources have no commits: %s", src.Type, source)
+	}
+
+	tagCommitsMu.Lock()
+	tags, ok := tagCommits[src.URL]
+	tagCommitsMu.Unlock()
+	if ok {
+		return tags, nil
+	}
+
+	// Like the HTTP cache, never reach out to the repository offline
+	if httpcache.Default.Offline {
+		return nil, fmt.Errorf("the commits of Git tags cannot be looked up offline and are not in the index: %s", source)
+	}
+
+	tags, err = fetchGitTags(src.URL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch Git tags: %v", err)
+	}
+	return tags, nil
+}
+
+// TagCommit returns the commit SHA a tag of a Git module points to.
+func TagCommit(source string, tag string) (string, error) {
+	tags, err := repositoryTags(source)
+	if err != nil {
+		return "", err
+	}
+	commit, ok := tags[tag]
+	if !ok {
+		return "", fmt.Errorf("tag '%s' not found for module: %s", tag, source)
+	}
+	return commit, nil
+}
+
+// CommitTagPattern infers the tag pattern of a Git module pinned to a commit from the
+// prefix of the release tags pointing to the commit, e.g. ^network/(.+)$ for
+// network/v1.4.0. When tags with different prefixes point to the commit, the prefix
+// naming the subdirectory of the module wins. It returns an empty pattern for commits
+// with an unprefixed release tag, without a release tag or with ambiguous prefixes, and
+// when the tags cannot be looked up (the error is reported by CommitTag).
+func CommitTagPattern(source string, commit string) string {
+	tags, err := repositoryTags(source)
+	if err != nil {
+		return ""
+	}
+
+	// Collect the prefixes of the release tags pointing to the commit
+	prefixes := make(map[string]bool)
+	for tag, tagCommit := range tags {
+		if tagCommit != commit {
+			continue
+		}
+		match := refPattern.FindStringSubmatch(tag)
+		if match == nil {
+			continue
+		}
+		if _, err := version.NewVersion(match[2]); err != nil {
+			continue
+		}
+		if match[1] == "" {
+			// An unprefixed release tag needs no pattern
+			return ""
+		}
+		prefixes[match[1]] = true
+	}
+
+	var prefix string
+	switch {
+	case len(prefixes) == 1:
+		for only := range prefixes {
+			prefix = only
+		}
+	case len(prefixes) > 1:
+		// Monorepo commits are often released for several modules at once
+		src, err := ParseSource(source)
+		if err != nil || src.Subdir == "" {
+			return ""
+		}
+		for candidate := range prefixes {
+			name := strings.Trim(candidate, "/-_@")
+			if name == src.Subdir || name == path.Base(src.Subdir) {
+				prefix = candidate
+			}
+		}
+	}
+	if prefix == "" {
+		return ""
+	}
+	return "^" + regexp.QuoteMeta(prefix) + "(.+)$"
+}
+
+// CommitTag returns the tag a commit of a Git module is released as, considering only
+// the tags selected by the tag pattern. When several tags point to the commit, the
+// highest version wins. An empty tag is returned for a commit that is not a release.
+func CommitTag(source string, commit string, pattern string) (string, error) {
+	var re *regexp.Regexp
+	if pattern != "" {
+		var err error
+		if re, err = regexp.Compile(pattern); err != nil {
+			return "", fmt.Errorf("invalid tag pattern '%s': %v", pattern, err)
+		}
+	}
+
+	tags, err := repositoryTags(source)
+	if err != nil {
+		return "", err
+	}
+
+	// Collect the release tags pointing to the commit
+	var names []string
+	versions := make(map[string]*version.Version)
+	for tag, tagCommit := range tags {
+		if tagCommit != commit {
+			continue
+		}
+		versionPart, ok := matchTag(re, tag)
+		if !ok {
+			continue
+		}
+		parsedVersion, err := version.NewVersion(versionPart)
+		if err != nil {
+			continue
+		}
+		names = append(names, tag)
+		versions[tag] = parsedVersion
+	}
+	if len(names) == 0 {
+		return "", nil
+	}
+
+	sort.Slice(names, func(i, j int) bool {
+		return versions[names[i]].GreaterThan(versions[names[j]])
+	})
+	return names[0], nil
+}
@@ -0,0 +1,53 @@
+package module
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCommitTagMonorepo(t *testing.T) {
+	first, second, third := strings.Repeat("a", 40), strings.Repeat("b", 40), strings.Repeat("c", 40)
+	if err := StoreTagCommits("git::https://example.com/mono.git", map[string]string{
+		"network/v1.4.0": first,
+		"dns/v2.0.0":     first,
+		"network/v1.5.0": second,
+		"v3.0.0":         third,
+		"latest":         third,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		source  string
+		commit  string
+		pattern string
+		tag     string
+	}{
+		// Several modules were released from the commit, the subdirectory picks one
+		{"git::https://example.com/mono.git//network?ref=" + first, first, `^network/(.+)$`, "network/v1.4.0"},
+		{"git::https://example.com/mono.git//modules/dns?ref=" + first, first, `^dns/(.+)$`, "dns/v2.0.0"},
+		{"git::https://example.com/mono.git//modules/vpc?ref=" + first, first, "", ""},
+		{"git::https://example.com/mono.git?ref=" + second, second, `^network/(.+)$`, "network/v1.5.0"},
+		{"git::https://example.com/mono.git?ref=" + third, third, "", "v3.0.0"},
+	}
+	for _, test := range tests {
+		pattern := CommitTagPattern(test.source, test.commit)
+		if pattern != test.pattern {
+			t.Errorf("CommitTagPattern(%q) = %q, want %q", test.source, pattern, test.pattern)
+			continue
+		}
+		tag, err := CommitTag(test.source, test.commit, pattern)
+		if err != nil || tag != test.tag {
+			t.Errorf("CommitTag(%q, %q) = %q, %v, want %q", test.source, pattern, tag, err, test.tag)
+		}
+	}
+
+	// The new ref keeps the prefix of the tag of the commit
+	if got := TagName("network/v1.4.0", `^network/(.+)$`, "v1.5.0"); got != "network/v1.5.0" {
+		t.Errorf("TagName = %q, want network/v1.5.0", got)
+	}
+	commit, err := TagCommit("git::https://example.com/mono.git//network?ref="+first, "network/v1.5.0")
+	if err != nil || commit != second {
+		t.Errorf("TagCommit = %q, %v, want %s", commit, err, second)
+	}
+}
@@ -2,46 +2,57 @@ package module
 
 import (
 	"fmt"
-	"strings"
-)
 
-// GetLatestModuleVersion retrieves the latest version of a module based on its source.
-func GetLatestModuleVersion(source string) (string, error) {
-	// Normalize the source by removing subdirectory information
-	normalizedSource := normalizeSource(source)
+	"github.com/hashicorp/go-version"
+)
 
-	// Check if the source is a Terraform Registry module
-	if isRegistryModule(normalizedSource) {
-		return getLatestVersionFromRegistry(source) // Pass the original source to handle submodules
+// ListModuleVersions retrieves all versions of a module based on its source, or on a
+// tagged address (see TaggedAddress) to only consider the matching Git tags.
+func ListModuleVersions(source string) ([]*version.Version, error) {
+	source, pattern := splitTaggedAddress(source)
+	src, err := ParseSource(source)
+	if err != nil {
+		return nil, err
 	}
 
-	// Check if the source is a Git-based module
-	if isGitModule(source) {
-		return getLatestVersionFromGit(source) // Fetch the latest tag from the Git repository
+	switch src.Type {
+	case SourceRegistry:
+		// Submodules share the versions of their package
+		return listVersionsFromRegistry(src.Registry)
+	case SourceGit:
+		// Fetch the tags from the Git repository
+		return listVersionsFromGit(src.URL, pattern)
 	}
 
-	// If the source format is not recognized, return an error
-	return "", fmt.Errorf("unsupported module source format: %s", source)
+	// Other sources are not versioned
+	return nil, fmt.Errorf("%s module sources have no versions: %s", src.Type, source)
 }
 
-// normalizeSource removes subdirectory information from the source.
-func normalizeSource(source string) string {
-	// Remove any double slashes and subdirectory information
-	if strings.Contains(source, "//") {
-		parts := strings.Split(source, "//")
-		return parts[0]
+// Address returns the address a module's versions are looked up by: its registry
+// address without subdirectory, or its Git repository. Modules from the same package
+// share it. Sources that cannot be parsed are returned unchanged.
+func Address(source string) string {
+	src, err := ParseSource(source)
+	if err != nil {
+		return source
 	}
-	return source
+	return src.Address()
+}
+
+// Versioned reports whether the versions of a module source can be looked up.
+func Versioned(source string) bool {
+	src, err := ParseSource(source)
+	return err == nil && src.Versioned()
 }
 
-// isRegistryModule checks if the source is a Terraform Registry module.
-func isRegistryModule(source string) bool {
-	// Terraform Registry modules are in the format: namespace/name/provider
-	parts := strings.Split(source, "/")
-	return len(parts) >= 3 && !strings.HasPrefix(source, "git@") && !strings.HasPrefix(source, "ssh://")
+// UsesRegistry reports whether the versions of a module come from a registry.
+func UsesRegistry(source string) bool {
+	src, err := ParseSource(source)
+	return err == nil && src.Type == SourceRegistry
 }
 
 // isGitModule checks if the source is a Git-based module.
 func isGitModule(source string) bool {
-	return strings.HasPrefix(source, "git@") || strings.HasPrefix(source, "ssh://") || strings.HasPrefix(source, "https://")
+	src, err := ParseSource(source)
+	return err == nil && src.Type == SourceGit
 }
@@ -1,20 +1,23 @@
 package module
 
 import (
+	"errors"
 	"fmt"
 	"log"
+	"regexp"
 	"sort"
-	"strings"
 
 	"github.com/go-git/go-git/v5/plumbing"                  // Git plumbing types
+	"github.com/go-git/go-git/v5/plumbing/protocol/packp"   // Advertised references
 	"github.com/go-git/go-git/v5/plumbing/transport"        // Git transport protocols
 	"github.com/go-git/go-git/v5/plumbing/transport/client" // Git client
-	"github.com/go-git/go-git/v5/plumbing/transport/ssh"    // SSH transport
 	"github.com/hashicorp/go-version"                       // Semantic version parsing
 )
 
-// fetchGitTags fetches all tags from a Git repository without cloning it.
-func fetchGitTags(source string) ([]string, error) {
+// fetchGitTags fetches all tags from a Git repository without cloning it, with the
+// commit each tag points to. Annotated tags are resolved to their commit when the
+// server advertises it.
+func fetchGitTags(source string) (map[string]string, error) {
 	// Parse the repository URL
 	ep, err := transport.NewEndpoint(source)
 	if err != nil {
@@ -27,60 +30,93 @@ func fetchGitTags(source string) ([]string, error) {
 		return nil, fmt.Errorf("failed to create Git client: %v", err)
 	}
 
-	// Open a session to the remote repository
-	session, err := gitClient.NewUploadPackSession(ep, getGitAuth(source))
+	// Authenticate with the credentials found for the repository
+	auth, err := getGitAuth(source, ep)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create upload pack session: %v", err)
+		return nil, fmt.Errorf("failed to set up Git authentication: %v", err)
 	}
-	defer session.Close()
 
-	// Fetch the advertised references (including tags)
-	refs, err := session.AdvertisedReferences()
+	refs, err := advertisedReferences(gitClient, ep, auth)
+	if errors.Is(err, transport.ErrAuthenticationRequired) && auth == nil && (ep.Protocol == "https" || ep.Protocol == "http") {
+		// Like git, only ask the credential helpers once the server requires it
+		credentialAuth, fillErr := credentialFill(ep)
+		if fillErr != nil {
+			return nil, fmt.Errorf("%v (%v)", err, fillErr)
+		}
+		refs, err = advertisedReferences(gitClient, ep, credentialAuth)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch advertised references: %v", err)
+		return nil, err
 	}
 
-	// Extract tag names
-	var tags []string
-	for refName := range refs.References {
+	// Extract tag names and their commits
+	tags := make(map[string]string)
+	for refName, hash := range refs.References {
 		// Convert refName to plumbing.ReferenceName
 		ref := plumbing.ReferenceName(refName)
-		if ref.IsTag() {
-			tags = append(tags, ref.Short())
+		if !ref.IsTag() {
+			continue
 		}
+		if commit, ok := refs.Peeled[refName]; ok {
+			hash = commit
+		}
+		tags[ref.Short()] = hash.String()
 	}
 
+	// Remember the commits for the modules pinned to one
+	storeTagCommits(source, tags)
+
 	return tags, nil
 }
 
-// getGitAuth returns the appropriate authentication method based on the Git URL.
-func getGitAuth(source string) transport.AuthMethod {
-	if strings.HasPrefix(source, "https://") {
-		// No authentication for public HTTPS repositories
-		return nil
-	} else if strings.HasPrefix(source, "ssh://") || strings.HasPrefix(source, "git@") {
-		// Use SSH authentication with the SSH agent
-		authMethod, err := ssh.DefaultAuthBuilder("git")
-		if err != nil {
-			log.Fatalf("Failed to create SSH auth method: %v", err)
-		}
-		return authMethod
+// advertisedReferences lists the references of a remote repository.
+func advertisedReferences(gitClient transport.Transport, ep *transport.Endpoint, auth transport.AuthMethod) (*packp.AdvRefs, error) {
+	// Open a session to the remote repository
+	session, err := gitClient.NewUploadPackSession(ep, auth)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create upload pack session: %w", err)
 	}
-	return nil
-}
+	defer session.Close()
 
-// getLatestVersionFromGit retrieves the latest version from a Git repository using the Go Git library.
-func getLatestVersionFromGit(source string) (string, error) {
-	// Fetch all tags from the Git repository
-	tags, err := fetchGitTags(source)
+	// Fetch the advertised references (including tags)
+	refs, err := session.AdvertisedReferences()
 	if err != nil {
-		return "", fmt.Errorf("failed to fetch Git tags: %v", err)
+		return nil, fmt.Errorf("failed to fetch advertised references: %w", err)
+	}
+	return refs, nil
+}
+
+// listVersionsFromGit retrieves all versions from a Git repository using the Go Git library.
+// With a tag pattern, only the matching tags are considered and their version is taken
+// from the first capture group of the pattern.
+func listVersionsFromGit(source string, pattern string) ([]*version.Version, error) {
+	var re *regexp.Regexp
+	if pattern != "" {
+		var err error
+		if re, err = regexp.Compile(pattern); err != nil {
+			return nil, fmt.Errorf("invalid tag pattern '%s': %v", pattern, err)
+		}
+	}
+
+	// Fetch all tags from the Git repository, unless a pinned module already did
+	tagCommitsMu.Lock()
+	tags, ok := tagCommits[source]
+	tagCommitsMu.Unlock()
+	if !ok {
+		var err error
+		if tags, err = fetchGitTags(source); err != nil {
+			return nil, fmt.Errorf("failed to fetch Git tags: %v", err)
+		}
 	}
 
 	// Parse tags into semantic version objects
 	versions := make([]*version.Version, 0, len(tags))
-	for _, tag := range tags {
-		parsedVersion, err := version.NewVersion(tag)
+	for tag := range tags {
+		versionPart, ok := matchTag(re, tag)
+		if !ok {
+			continue
+		}
+		parsedVersion, err := version.NewVersion(versionPart)
 		if err != nil {
 			log.Printf("Warning: Skipping invalid version %s: %v", tag, err)
 			continue
@@ -100,12 +136,12 @@ func getLatestVersionFromGit(source string) (string, error) {
 	}
 	log.Printf("All versions of module %s: %v", source, versionStrings)
 
-	// Log the latest version
+	if len(versions) == 0 && pattern != "" {
+		return nil, fmt.Errorf("no tags matching '%s' found for module: %s", pattern, source)
+	}
 	if len(versions) == 0 {
-		return "", fmt.Errorf("no valid versions found for module: %s", source)
+		return nil, fmt.Errorf("no valid versions found for module: %s", source)
 	}
-	latestVersion := versions[0].String()
-	log.Printf("Latest version of module %s: %s", source, latestVersion)
 
-	return latestVersion, nil
+	return versions, nil
 }
@@ -0,0 +1,400 @@
+package module
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+var (
+	// SSHKeyFiles are private keys offered for SSH Git sources before the SSH agent,
+	// configured by the CLI.
+	SSHKeyFiles []string
+	// KnownHostsFiles are the known_hosts files SSH host keys are checked against.
+	// When empty, $SSH_KNOWN_HOSTS, ~/.ssh/known_hosts and /etc/ssh/ssh_known_hosts are used.
+	KnownHostsFiles []string
+)
+
+var (
+	sshKeysMu sync.Mutex
+	sshKeys   = make(map[string]string) // Repository URL -> sshkey query argument
+
+	credentialsMu sync.Mutex
+	credentials   = make(map[string]*githttp.BasicAuth) // Host -> credentials from git credential fill
+)
+
+// UseSourceCredentials records the credentials embedded in a Git module source (the
+// sshkey query argument) for the lookups of its repository, whose address does not
+// carry them.
+func UseSourceCredentials(source string) {
+	src, err := ParseSource(source)
+	if err != nil || src.Type != SourceGit || src.Query.Get("sshkey") == "" {
+		return
+	}
+
+	sshKeysMu.Lock()
+	defer sshKeysMu.Unlock()
+	sshKeys[src.URL] = src.Query.Get("sshkey")
+}
+
+// getGitAuth returns the authentication method for a Git endpoint. HTTPS endpoints
+// get credentials from the URL, token environment variables or .netrc (nil when there
+// are none); SSH endpoints get the sshkey of the source, the configured key files, the
+// SSH agent and the default key files.
+func getGitAuth(source string, ep *transport.Endpoint) (transport.AuthMethod, error) {
+	switch ep.Protocol {
+	case "http", "https":
+		return httpAuth(ep), nil
+	case "ssh":
+		return sshAuth(source, ep)
+	}
+	return nil, nil
+}
+
+// httpAuth returns the non-interactive credentials for an HTTP(S) endpoint.
+func httpAuth(ep *transport.Endpoint) transport.AuthMethod {
+	// Credentials in the URL are used by go-git itself
+	if ep.User != "" {
+		return nil
+	}
+
+	if auth := tokenAuth(ep.Host); auth != nil {
+		log.Printf("Using token from the environment for %s", ep.Host)
+		return auth
+	}
+
+	if auth := netrcAuth(ep.Host); auth != nil {
+		log.Printf("Using .netrc credentials for %s", ep.Host)
+		return auth
+	}
+
+	return nil
+}
+
+// tokenAuth returns basic auth from the GitHub or GitLab token environment variables
+// matching a host.
+func tokenAuth(host string) *githttp.BasicAuth {
+	// GitHub, including GitHub Enterprise Server through GH_HOST or GITHUB_SERVER_URL
+	githubHosts := []string{"github.com", os.Getenv("GH_HOST"), hostOf(os.Getenv("GITHUB_SERVER_URL"))}
+	if containsHost(githubHosts, host) {
+		for _, name := range []string{"GITHUB_TOKEN", "GH_TOKEN"} {
+			if token := os.Getenv(name); token != "" {
+				return &githttp.BasicAuth{Username: "x-access-token", Password: token}
+			}
+		}
+	}
+
+	// GitLab, including self-managed instances through GITLAB_HOST or CI_SERVER_HOST
+	gitlabHosts := []string{"gitlab.com", hostOf(os.Getenv("GITLAB_HOST")), os.Getenv("CI_SERVER_HOST")}
+	if containsHost(gitlabHosts, host) {
+		if token := os.Getenv("GITLAB_TOKEN"); token != "" {
+			return &githttp.BasicAuth{Username: "oauth2", Password: token}
+		}
+		if token := os.Getenv("CI_JOB_TOKEN"); token != "" {
+			return &githttp.BasicAuth{Username: "gitlab-ci-token", Password: token}
+		}
+	}
+
+	return nil
+}
+
+// hostOf returns the host of a URL or of a bare hostname.
+func hostOf(value string) string {
+	value = strings.TrimPrefix(strings.TrimPrefix(value, "https://"), "http://")
+	host, _, _ := strings.Cut(value, "/")
+	return host
+}
+
+// containsHost checks if a host is in a list, ignoring case and empty entries.
+func containsHost(hosts []string, host string) bool {
+	for _, candidate := range hosts {
+		if candidate != "" && strings.EqualFold(candidate, host) {
+			return true
+		}
+	}
+	return false
+}
+
+// netrcAuth returns the credentials of a host from $NETRC or ~/.netrc.
+func netrcAuth(host string) *githttp.BasicAuth {
+	path := os.Getenv("NETRC")
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil
+		}
+		path = filepath.Join(home, ".netrc")
+		if runtime.GOOS == "windows" {
+			path = filepath.Join(home, "_netrc")
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+
+	// Entries are "machine <host> login <user> password <secret>", or "default ..."
+	var auth, fallback *githttp.BasicAuth
+	var current *githttp.BasicAuth
+	fields := strings.Fields(string(data))
+	for i := 0; i < len(fields); i++ {
+		switch fields[i] {
+		case "machine":
+			current = nil
+			if i+1 < len(fields) {
+				i++
+				if strings.EqualFold(fields[i], host) && auth == nil {
+					auth = &githttp.BasicAuth{}
+					current = auth
+				}
+			}
+		case "default":
+			current = nil
+			if fallback == nil {
+				fallback = &githttp.BasicAuth{}
+				current = fallback
+			}
+		case "login", "password", "account":
+			if i+1 >= len(fields) {
+				break
+			}
+			i++
+			if current != nil && fields[i-1] == "login" {
+				current.Username = fields[i]
+			} else if current != nil && fields[i-1] == "password" {
+				current.Password = fields[i]
+			}
+		case "macdef":
+			// Macros run until an empty line, they never hold credentials
+			current = nil
+		}
+	}
+
+	if auth != nil && auth.Password != "" {
+		return auth
+	}
+	if fallback != nil && fallback.Password != "" {
+		return fallback
+	}
+	return nil
+}
+
+// credentialFill asks git for the credentials of an HTTP(S) endpoint, the way git
+// itself does after a 401: through the configured credential helpers, or GIT_ASKPASS
+// when there is none. Terminal prompts are disabled. Answers are cached per host.
+func credentialFill(ep *transport.Endpoint) (*githttp.BasicAuth, error) {
+	credentialsMu.Lock()
+	defer credentialsMu.Unlock()
+
+	if auth, ok := credentials[ep.Host]; ok {
+		if auth == nil {
+			return nil, fmt.Errorf("no credentials available for %s", ep.Host)
+		}
+		return auth, nil
+	}
+
+	auth, err := runCredentialFill(ep)
+	if err != nil {
+		log.Printf("Warning: Failed to get Git credentials for %s: %v", ep.Host, err)
+	}
+	credentials[ep.Host] = auth
+	if auth == nil {
+		return nil, fmt.Errorf("no credentials available for %s", ep.Host)
+	}
+	return auth, nil
+}
+
+// runCredentialFill runs `git credential fill`, or GIT_ASKPASS when git is missing.
+func runCredentialFill(ep *transport.Endpoint) (*githttp.BasicAuth, error) {
+	host := ep.Host
+	if ep.Port != 0 && ep.Port != 443 && ep.Port != 80 {
+		host = fmt.Sprintf("%s:%d", ep.Host, ep.Port)
+	}
+
+	gitPath, err := exec.LookPath("git")
+	if err != nil {
+		return askPass(ep.Protocol + "://" + host)
+	}
+
+	input := fmt.Sprintf("protocol=%s\nhost=%s\npath=%s\n\n", ep.Protocol, host, strings.TrimPrefix(ep.Path, "/"))
+	cmd := exec.Command(gitPath, "credential", "fill")
+	cmd.Stdin = strings.NewReader(input)
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("git credential fill: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	auth := &githttp.BasicAuth{}
+	scanner := bufio.NewScanner(&stdout)
+	for scanner.Scan() {
+		key, value, _ := strings.Cut(scanner.Text(), "=")
+		switch key {
+		case "username":
+			auth.Username = value
+		case "password":
+			auth.Password = value
+		}
+	}
+	if auth.Password == "" {
+		return nil, nil
+	}
+	return auth, nil
+}
+
+// askPass asks GIT_ASKPASS (or SSH_ASKPASS) for a username and password.
+func askPass(url string) (*githttp.BasicAuth, error) {
+	program := os.Getenv("GIT_ASKPASS")
+	if program == "" {
+		program = os.Getenv("SSH_ASKPASS")
+	}
+	if program == "" {
+		return nil, nil
+	}
+
+	ask := func(prompt string) (string, error) {
+		out, err := exec.Command(program, prompt).Output()
+		if err != nil {
+			return "", fmt.Errorf("%s: %v", program, err)
+		}
+		return strings.TrimRight(string(out), "\r\n"), nil
+	}
+
+	username, err := ask(fmt.Sprintf("Username for '%s': ", url))
+	if err != nil {
+		return nil, err
+	}
+	password, err := ask(fmt.Sprintf("Password for '%s': ", strings.Replace(url, "://", "://"+username+"@", 1)))
+	if err != nil {
+		return nil, err
+	}
+	return &githttp.BasicAuth{Username: username, Password: password}, nil
+}
+
+// sshAuth returns the public key authentication for an SSH endpoint.
+func sshAuth(source string, ep *transport.Endpoint) (transport.AuthMethod, error) {
+	user := ep.User
+	if user == "" {
+		user = "git"
+	}
+
+	// Check host keys against known_hosts, a missing file is an error rather than a prompt
+	hostKeyCallback, err := ssh.NewKnownHostsCallback(KnownHostsFiles...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load known_hosts: %v", err)
+	}
+
+	// Explicit keys come first: the sshkey of the source, then the configured files
+	var signers []gossh.Signer
+	sshKeysMu.Lock()
+	sshKey := sshKeys[source]
+	sshKeysMu.Unlock()
+	if sshKey != "" {
+		signer, err := parseSSHKey(sshKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid sshkey for %s: %v", source, err)
+		}
+		signers = append(signers, signer)
+	}
+	for _, file := range SSHKeyFiles {
+		signer, err := readSSHKey(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read SSH key %s: %v", file, err)
+		}
+		signers = append(signers, signer)
+	}
+	explicit := len(signers) > 0
+
+	// Then the keys of the SSH agent, and the default key files without explicit keys
+	callback := func() ([]gossh.Signer, error) {
+		all := append([]gossh.Signer{}, signers...)
+		if agentAuth, err := ssh.NewSSHAgentAuth(user); err == nil {
+			if agentSigners, err := agentAuth.Callback(); err == nil {
+				all = append(all, agentSigners...)
+			}
+		}
+		if !explicit {
+			all = append(all, defaultSSHKeys()...)
+		}
+		if len(all) == 0 {
+			return nil, fmt.Errorf("no SSH keys available (no sshkey, --ssh-key, SSH agent or ~/.ssh/id_* key)")
+		}
+		return all, nil
+	}
+
+	auth := &ssh.PublicKeysCallback{User: user, Callback: callback}
+	auth.HostKeyCallback = hostKeyCallback
+	return auth, nil
+}
+
+// parseSSHKey parses the sshkey query argument: a base64-encoded private key, as
+// go-getter expects, or the path of a private key file. An existing file wins, since
+// short paths such as deploykey are valid base64 too.
+func parseSSHKey(value string) (gossh.Signer, error) {
+	if _, err := os.Stat(expandHome(value)); err == nil {
+		return readSSHKey(value)
+	}
+	data, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return readSSHKey(value)
+	}
+	signer, err := gossh.ParsePrivateKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("neither a key file nor a base64-encoded private key: %v", err)
+	}
+	return signer, nil
+}
+
+// readSSHKey reads a private key file. Keys protected by a passphrase are not supported,
+// load them in the SSH agent instead.
+func readSSHKey(path string) (gossh.Signer, error) {
+	data, err := os.ReadFile(expandHome(path))
+	if err != nil {
+		return nil, err
+	}
+	return gossh.ParsePrivateKey(data)
+}
+
+// expandHome replaces the ~/ prefix of a path with the home directory of the user.
+func expandHome(path string) string {
+	if strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, path[2:])
+		}
+	}
+	return path
+}
+
+// defaultSSHKeys reads the default private key files of the user that can be used
+// without a passphrase.
+func defaultSSHKeys() []gossh.Signer {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil
+	}
+
+	var signers []gossh.Signer
+	for _, name := range []string{"id_ed25519", "id_ecdsa", "id_rsa"} {
+		signer, err := readSSHKey(filepath.Join(home, ".ssh", name))
+		if err != nil {
+			continue
+		}
+		signers = append(signers, signer)
+	}
+	return signers
+}
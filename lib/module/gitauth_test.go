@@ -0,0 +1,50 @@
+package module
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	gossh "golang.org/x/crypto/ssh"
+)
+
+func TestParseSSHKey(t *testing.T) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := gossh.MarshalPrivateKey(key, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := pem.EncodeToMemory(block)
+
+	// deploykey is valid base64, but names a key file of the working directory
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "deploykey"), data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(cwd)
+
+	for _, value := range []string{"deploykey", filepath.Join(dir, "deploykey"), base64.StdEncoding.EncodeToString(data)} {
+		if _, err := parseSSHKey(value); err != nil {
+			t.Errorf("parseSSHKey(%q) returned an error: %v", value, err)
+		}
+	}
+	for _, value := range []string{"missingkey", "not a key!", base64.StdEncoding.EncodeToString([]byte("garbage"))} {
+		if _, err := parseSSHKey(value); err == nil {
+			t.Errorf("parseSSHKey(%q) returned no error", value)
+		}
+	}
+}
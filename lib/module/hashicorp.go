@@ -3,74 +3,109 @@ package module
 import (
 	"encoding/json"
 	"fmt"
-	"io"
 	"log"
-	"net/http"
+	"regexp"
 	"sort"
 	"strings"
 
+	"tfau/lib/httpcache"
+	"tfau/lib/registry"
+
 	"github.com/hashicorp/go-version"
 )
 
-// getLatestVersionFromRegistry retrieves the latest version of a Terraform Registry module.
-func getLatestVersionFromRegistry(source string) (string, error) {
-	// Normalize the source to handle submodules
-	normalizedSource := normalizeSource(source)
-	parts := strings.Split(normalizedSource, "/")
-	if len(parts) < 3 {
-		return "", fmt.Errorf("invalid Terraform Registry module source: %s", source)
+var (
+	// registryLabelPattern matches a namespace or module name
+	registryLabelPattern = regexp.MustCompile(`^[0-9A-Za-z](?:[0-9A-Za-z-_]{0,62}[0-9A-Za-z])?$`)
+	// registryProviderPattern matches the target system of a module
+	registryProviderPattern = regexp.MustCompile(`^[0-9a-z]{1,64}$`)
+)
+
+// RegistrySource is a module registry source address:
+// [<HOSTNAME>/]<NAMESPACE>/<NAME>/<PROVIDER>[//<SUBDIR>].
+type RegistrySource struct {
+	Host      string // Registry hostname, registry.DefaultHost when omitted
+	Namespace string
+	Name      string
+	Provider  string
+	Subdir    string // Optional subdirectory (submodule) within the package
+}
+
+// ParseRegistrySource parses a module registry source address.
+func ParseRegistrySource(source string) (*RegistrySource, error) {
+	address, subdir := source, ""
+	if i := strings.Index(source, "//"); i >= 0 {
+		address, subdir = source[:i], source[i+len("//"):]
 	}
-	namespace, name, provider := parts[0], parts[1], parts[2]
 
-	// Check if the source is a submodule
-	isSubmodule := strings.Contains(source, "//")
-	submodulePath := ""
-	if isSubmodule {
-		submodulePath = strings.Split(source, "//")[1]
+	parts := strings.Split(address, "/")
+	host := registry.DefaultHost
+	switch len(parts) {
+	case 3:
+	case 4:
+		// The first part is a hostname, e.g. app.terraform.io or localhost:8080
+		if !isRegistryHost(parts[0]) {
+			return nil, fmt.Errorf("invalid registry hostname '%s' in module source: %s", parts[0], source)
+		}
+		// Like Terraform, these are repository shorthands rather than registries
+		if host := strings.ToLower(parts[0]); host == "github.com" || host == "bitbucket.org" {
+			return nil, fmt.Errorf("%s is not a module registry: %s", host, source)
+		}
+		host, parts = strings.ToLower(parts[0]), parts[1:]
+	default:
+		return nil, fmt.Errorf("invalid module registry source: %s", source)
 	}
 
-	// Correct the namespace and name if they are incorrect
-	if namespace == "GoogleCloudPlatform" && name == "sql-db" {
-		namespace = "terraform-google-modules"
+	if !registryLabelPattern.MatchString(parts[0]) || !registryLabelPattern.MatchString(parts[1]) || !registryProviderPattern.MatchString(parts[2]) {
+		return nil, fmt.Errorf("invalid module registry source: %s", source)
 	}
 
-	// Construct the Terraform Registry API URL
-	var apiURL string
-	if isSubmodule {
-		// For submodules, use the root module's API endpoint
-		apiURL = fmt.Sprintf("https://registry.terraform.io/v1/modules/%s/%s/%s/versions", namespace, name, provider)
-	} else {
-		// For root modules, use the standard API endpoint
-		apiURL = fmt.Sprintf("https://registry.terraform.io/v1/modules/%s/%s/%s/versions", namespace, name, provider)
+	return &RegistrySource{
+		Host:      host,
+		Namespace: parts[0],
+		Name:      parts[1],
+		Provider:  parts[2],
+		Subdir:    subdir,
+	}, nil
+}
+
+// String returns the registry address without subdirectory, with its hostname.
+func (s *RegistrySource) String() string {
+	return s.Host + "/" + s.Namespace + "/" + s.Name + "/" + s.Provider
+}
+
+// isRegistryHost checks if a source part looks like a hostname, with an optional port.
+func isRegistryHost(part string) bool {
+	host := part
+	if i := strings.LastIndex(part, ":"); i >= 0 {
+		host = part[:i]
 	}
+	return host == "localhost" || (strings.Contains(host, ".") && !strings.ContainsAny(host, "@?=&"))
+}
+
+// listVersionsFromRegistry retrieves all versions of a module from its registry.
+func listVersionsFromRegistry(registrySource *RegistrySource) ([]*version.Version, error) {
+	source := registrySource.String()
+	namespace, name, provider := registrySource.Namespace, registrySource.Name, registrySource.Provider
 
-	// Create an HTTP client that follows redirects
-	client := &http.Client{
-		CheckRedirect: func(req *http.Request, via []*http.Request) error {
-			// Allow up to 10 redirects
-			if len(via) >= 10 {
-				return fmt.Errorf("too many redirects")
-			}
-			return nil
-		},
+	// Correct the namespace and name if they are incorrect
+	if namespace == "GoogleCloudPlatform" && name == "sql-db" {
+		namespace = "terraform-google-modules"
 	}
 
-	// Make an HTTP GET request to the Terraform Registry API
-	resp, err := client.Get(apiURL)
+	// Discover where the module's host serves the module registry API
+	modulesURL, err := registry.ServiceURL(registrySource.Host, registry.ModulesV1)
 	if err != nil {
-		return "", fmt.Errorf("failed to fetch module versions from Terraform Registry: %v", err)
+		return nil, err
 	}
-	defer resp.Body.Close()
 
-	// Check the response status code
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("Terraform Registry API returned status code %d for URL: %s", resp.StatusCode, apiURL)
-	}
+	// Construct the module registry API URL. Submodules share the versions of their root module.
+	apiURL := fmt.Sprintf("%s%s/%s/%s/versions", modulesURL, namespace, name, provider)
 
-	// Read the response body
-	body, err := io.ReadAll(resp.Body)
+	// Fetch the versions through the HTTP cache (redirects are followed)
+	body, err := httpcache.Get(apiURL)
 	if err != nil {
-		return "", fmt.Errorf("failed to read API response body: %v", err)
+		return nil, fmt.Errorf("failed to fetch module versions from registry %s: %v", registrySource.Host, err)
 	}
 
 	// Parse the response JSON
@@ -82,12 +117,12 @@ func getLatestVersionFromRegistry(source string) (string, error) {
 		} `json:"modules"`
 	}
 	if err := json.Unmarshal(body, &result); err != nil {
-		return "", fmt.Errorf("failed to decode Terraform Registry API response: %v", err)
+		return nil, fmt.Errorf("failed to decode registry API response: %v", err)
 	}
 
 	// Extract versions
 	if len(result.Modules) == 0 || len(result.Modules[0].Versions) == 0 {
-		return "", fmt.Errorf("no versions found for module: %s", source)
+		return nil, fmt.Errorf("no versions found for module: %s", source)
 	}
 
 	// Parse versions into semantic version objects
@@ -113,14 +148,9 @@ func getLatestVersionFromRegistry(source string) (string, error) {
 	}
 	log.Printf("All versions of module %s: %v", source, versionStrings)
 
-	// Log the latest version
-	latestVersion := versions[0].String()
-	log.Printf("Latest version of module %s: %s", source, latestVersion)
-
-	// Special log for GoogleCloudPlatform/sql-db/google//modules/postgresql
-	if normalizedSource == "GoogleCloudPlatform/sql-db/google" && submodulePath == "modules/postgresql" {
-		log.Printf("Latest version of GoogleCloudPlatform/sql-db/google//modules/postgresql: %s", latestVersion)
+	if len(versions) == 0 {
+		return nil, fmt.Errorf("no valid versions found for module: %s", source)
 	}
 
-	return latestVersion, nil
+	return versions, nil
 }
@@ -0,0 +1,53 @@
+package module
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// manifestPath is where terraform init records the modules installed for a root
+// module, relative to its data directory.
+const manifestPath = "modules/modules.json"
+
+// ManifestEntry is a module installed by terraform init.
+type ManifestEntry struct {
+	Key     string `json:"Key"`     // Module path, e.g. vpc.subnets, empty for the root module
+	Source  string `json:"Source"`  // Source address as written in the module block
+	Version string `json:"Version"` // Selected version of registry modules
+	Dir     string `json:"Dir"`     // Directory of the module, relative to the root module
+}
+
+// DataDir returns the data directory of a root module: .terraform, or TF_DATA_DIR.
+func DataDir(root string) string {
+	dir := os.Getenv("TF_DATA_DIR")
+	if dir == "" {
+		dir = ".terraform"
+	}
+	if filepath.IsAbs(dir) {
+		return dir
+	}
+	return filepath.Join(root, dir)
+}
+
+// ReadManifest reads the modules installed for a root module by terraform init. It
+// returns nil without an error when the root module was not initialized.
+func ReadManifest(root string) ([]ManifestEntry, error) {
+	data, err := os.ReadFile(filepath.Join(DataDir(root), manifestPath))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read module manifest: %v", err)
+	}
+
+	var manifest struct {
+		Modules []ManifestEntry `json:"Modules"`
+	}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal module manifest: %v", err)
+	}
+	return manifest.Modules, nil
+}
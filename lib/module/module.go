@@ -2,11 +2,11 @@ package module
 
 import (
 	"fmt"
-	"io/ioutil"
 	"log"
-	"net/url"
 	"strings"
 
+	"tfau/lib/constraint"
+
 	"github.com/hashicorp/hcl/v2"
 	"github.com/hashicorp/hcl/v2/hclsyntax"
 	"github.com/hashicorp/hcl/v2/hclwrite"
@@ -46,27 +46,12 @@ func Extract(content *hcl.BodyContent) (map[string]map[string]string, error) {
 
 			source := sourceValue.AsString()
 
-			// Handle Git SSH URLs (e.g., git@github.com:user/repo.git)
-			if strings.HasPrefix(source, "git@") {
-				source = strings.Replace(source, ":", "/", 1) // Replace the first colon with a slash
-				source = "ssh://" + source                    // Prepend with ssh://
-			}
-
-			// Parse the source URL to extract the version from the query parameter if it exists
-			if strings.Contains(source, "?") {
-				parsedURL, err := url.Parse(source)
-				if err != nil {
-					return nil, fmt.Errorf("failed to parse source URL for module '%s': %s", moduleName, err)
-				}
-
-				// Extract the version from the query parameter
-				version := parsedURL.Query().Get("ref")
-				if version != "" {
-					moduleInfo["version"] = version
-				}
-
-				// Remove the query parameter from the source
-				source = strings.Split(source, "?")[0]
+			// Extract the version from the ref query parameter of remote sources
+			src, err := ParseSource(source)
+			if err != nil {
+				log.Printf("Warning: Module '%s' has an unrecognized source: %v", moduleName, err)
+			} else if ref := src.Ref(); ref != "" {
+				moduleInfo["version"] = ref
 			}
 
 			moduleInfo["source"] = source
@@ -88,37 +73,16 @@ func Extract(content *hcl.BodyContent) (map[string]map[string]string, error) {
 			modules[moduleName] = moduleInfo
 
 			log.Printf("Module name: %s, source: %s, version: %s\n", moduleName, moduleInfo["source"], moduleInfo["version"])
-
-			// Get the latest version of the module (if needed)
-			if moduleInfo["source"] != "" {
-				latestVersion, err := GetLatestModuleVersion(moduleInfo["source"])
-				if err != nil {
-					log.Printf("Warning: Failed to retrieve latest version for module '%s': %v\n", moduleName, err)
-				} else {
-					fmt.Printf("Latest version of %s: %s\n", moduleInfo["source"], latestVersion)
-				}
-			}
 		}
 	}
 
 	return modules, nil
 }
 
-// UpdateModuleVersions updates the module versions in the HCL content and writes it back to the file.
+// UpdateModuleVersions updates the module versions in the in-memory HCL document.
 // It updates both the version attribute and the ref parameter in the source attribute.
-func UpdateModuleVersions(filename string, latestVersions map[string]string) error {
-	// Read the file content
-	src, err := ioutil.ReadFile(filename)
-	if err != nil {
-		return fmt.Errorf("failed to read file: %v", err)
-	}
-
-	// Parse the HCL content
-	file, diags := hclwrite.ParseConfig(src, filename, hcl.Pos{Line: 1, Column: 1})
-	if diags.HasErrors() {
-		return fmt.Errorf("failed to parse HCL content: %s", diags)
-	}
-
+// The latest versions of Git modules are the tag names to write as ref.
+func UpdateModuleVersions(file *hclwrite.File, latestVersions map[string]string) {
 	// Iterate over the blocks to find module blocks
 	body := file.Body()
 	for _, block := range body.Blocks() {
@@ -128,56 +92,113 @@ func UpdateModuleVersions(filename string, latestVersions map[string]string) err
 
 			// Check if the module has a latest version
 			if latestVersion, exists := latestVersions[moduleName]; exists {
-				// Update the version attribute if it exists
+				// Update the version attribute if it exists, keeping the constraint style
 				if attr := block.Body().GetAttribute("version"); attr != nil {
-					log.Printf("Updating module '%s' to version '%s'", moduleName, latestVersion)
-					block.Body().SetAttributeValue("version", cty.StringVal(latestVersion))
+					currentVersion, err := attributeString(attr)
+					if err != nil {
+						log.Printf("Warning: Skipping version of module '%s': %v", moduleName, err)
+					} else if newVersion, err := constraint.Rewrite(currentVersion, latestVersion); err != nil {
+						log.Printf("Warning: Skipping version of module '%s': %v", moduleName, err)
+					} else {
+						log.Printf("Updating module '%s' from '%s' to '%s'", moduleName, currentVersion, newVersion)
+						block.Body().SetAttributeValue("version", cty.StringVal(newVersion))
+					}
 				}
 
-				// Update the ref parameter in the source attribute if it exists
-				sourceAttr := block.Body().GetAttribute("source")
-				if sourceAttr != nil {
-					// Get the source value as a string
-					sourceTokens := sourceAttr.Expr().BuildTokens(nil)
-					sourceValue := string(sourceTokens.Bytes())
-
-					if strings.Contains(sourceValue, "?ref=") {
-						// Update the ref in the source attribute, preserving the "v" prefix
-						newSource := strings.Split(sourceValue, "?ref=")[0] + "?ref=v" + latestVersion
-
-						// Manually construct the tokens for the source attribute
-						sourceTokens := hclwrite.Tokens{
-							{Type: hclsyntax.TokenStringLit, Bytes: []byte(newSource)},
-							{Type: hclsyntax.TokenCQuote, Bytes: []byte(`"`)},
+				// Update the ref parameter of Git sources with the exact tag name
+				if sourceAttr := block.Body().GetAttribute("source"); sourceAttr != nil {
+					source, err := attributeString(sourceAttr)
+					if err != nil {
+						log.Printf("Warning: Skipping source of module '%s': %v", moduleName, err)
+					} else if isGitModule(source) {
+						// Sources pinned to a commit are pinned to the commit of the tag
+						ref, pinned := latestVersion, isPinned(source)
+						if pinned {
+							if ref, err = TagCommit(source, latestVersion); err != nil {
+								log.Printf("Warning: Skipping source of module '%s': %v", moduleName, err)
+								continue
+							}
 						}
 
-						// Replace the source attribute with the new tokens
-						block.Body().SetAttributeRaw("source", sourceTokens)
-						log.Printf("Updated source attribute for module '%s' to version 'v%s'", moduleName, latestVersion)
-					} else if strings.HasPrefix(sourceValue, "git@") || strings.HasPrefix(sourceValue, "ssh://") {
-						// If the source is a Git URL without a ref, add the ref parameter with the "v" prefix
-						newSource := sourceValue + "?ref=v" + latestVersion
-
-						// Manually construct the tokens for the source attribute
-						sourceTokens := hclwrite.Tokens{
-							{Type: hclsyntax.TokenStringLit, Bytes: []byte(newSource)},
-							{Type: hclsyntax.TokenCQuote, Bytes: []byte(`"`)},
-						}
+						newSource := replaceRef(source, ref)
+						if newSource != source {
+							block.Body().SetAttributeValue("source", cty.StringVal(newSource))
+							log.Printf("Updated source attribute for module '%s' to ref '%s'", moduleName, ref)
 
-						// Replace the source attribute with the new tokens
-						block.Body().SetAttributeRaw("source", sourceTokens)
-						log.Printf("Added ref to source attribute for module '%s': %s", moduleName, newSource)
+							// Keep the tag of the commit readable in the trailing comment
+							if pinned {
+								setTagComment(block.Body().GetAttribute("source"), latestVersion)
+							}
+						}
 					}
 				}
 			}
 		}
 	}
+}
 
-	// Write the updated content back to the file
-	if err := ioutil.WriteFile(filename, file.Bytes(), 0644); err != nil {
-		return fmt.Errorf("failed to write file: %v", err)
+// ProposedVersion returns the version UpdateModuleVersions writes for a module: the
+// rewritten constraint for registry modules, or the new ref for Git modules (the tag
+// name, or the commit of the tag for modules pinned to a commit).
+func ProposedVersion(source string, current string, latestVersion string) (string, error) {
+	if isPinned(source) {
+		return TagCommit(source, latestVersion)
+	}
+	if isGitModule(source) {
+		return latestVersion, nil
 	}
+	return constraint.Rewrite(current, latestVersion)
+}
 
-	log.Printf("Successfully updated module versions in file: %s", filename)
-	return nil
+// isPinned checks if the source is a Git-based module pinned to a commit SHA.
+func isPinned(source string) bool {
+	src, err := ParseSource(source)
+	return err == nil && src.Type == SourceGit && IsCommitSHA(src.Ref())
+}
+
+// setTagComment sets the trailing comment of a source pinned to a commit to the tag of
+// the commit (source = "...?ref=<sha>" # v1.6.0). A comment is added when missing, and
+// comments that are not a tag are kept. hclwrite has no API for comments, so the
+// tokens of the attribute are edited in place.
+func setTagComment(attr *hclwrite.Attribute, tag string) {
+	if attr == nil {
+		return
+	}
+	tokens := attr.BuildTokens(nil)
+	last := tokens[len(tokens)-1]
+
+	switch last.Type {
+	case hclsyntax.TokenComment:
+		// Replace the tag of # and // comments, keeping the comment marker
+		text := strings.TrimSpace(string(last.Bytes))
+		marker := "#"
+		if strings.HasPrefix(text, "//") {
+			marker = "//"
+		} else if !strings.HasPrefix(text, "#") {
+			return
+		}
+		if body := strings.TrimSpace(strings.TrimPrefix(text, marker)); strings.ContainsAny(body, " \t") || !refPattern.MatchString(body) {
+			return
+		}
+		last.Bytes = []byte(marker + " " + tag + "\n")
+	case hclsyntax.TokenNewline:
+		// Add the comment before the end of the line
+		last.Type, last.Bytes, last.SpacesBefore = hclsyntax.TokenComment, []byte("# "+tag+"\n"), 1
+	}
+}
+
+// attributeString evaluates a literal string attribute of an hclwrite body.
+func attributeString(attr *hclwrite.Attribute) (string, error) {
+	expr, diags := hclsyntax.ParseExpression(attr.Expr().BuildTokens(nil).Bytes(), "", hcl.Pos{Line: 1, Column: 1})
+	if diags.HasErrors() {
+		return "", fmt.Errorf("failed to parse expression: %s", diags)
+	}
+	value, diags := expr.Value(nil)
+	if diags.HasErrors() {
+		return "", fmt.Errorf("failed to evaluate expression: %s", diags)
+	}
+	if value.Type() != cty.String || value.IsNull() {
+		return "", fmt.Errorf("expression is not a string")
+	}
+	return value.AsString(), nil
 }
@@ -0,0 +1,277 @@
+package module
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// SourceType is the kind of location a module source address points to.
+type SourceType string
+
+const (
+	SourceLocal    SourceType = "local"    // Relative path within the same package (./ or ../)
+	SourceRegistry SourceType = "registry" // Module registry address
+	SourceGit      SourceType = "git"      // Git repository
+	SourceHg       SourceType = "hg"       // Mercurial repository
+	SourceHTTP     SourceType = "http"     // HTTP URL, usually an archive
+	SourceS3       SourceType = "s3"       // Amazon S3 bucket object
+	SourceGCS      SourceType = "gcs"      // Google Cloud Storage object
+)
+
+// forcedGetters are the go-getter prefixes that force a source type (git::https://...).
+var forcedGetters = map[string]SourceType{
+	"git":   SourceGit,
+	"hg":    SourceHg,
+	"http":  SourceHTTP,
+	"https": SourceHTTP,
+	"s3":    SourceS3,
+	"gcs":   SourceGCS,
+}
+
+// scpLikePattern matches SCP-like Git addresses, e.g. git@github.com:org/repo.git.
+var scpLikePattern = regexp.MustCompile(`^([0-9A-Za-z._-]+@)?([0-9A-Za-z.-]+):([^/].*)$`)
+
+// Source is a module source address, parsed the way Terraform detects go-getter
+// sources: local paths, registry addresses, forced getters (git::), shorthand hosts
+// (github.com/org/repo), subdirectories (//subdir) and query arguments (?ref=v1).
+type Source struct {
+	Raw      string          // Source as written in the module block
+	Type     SourceType      // Kind of location
+	URL      string          // Remote location without subdirectory and query, e.g. the Git clone URL
+	Subdir   string          // Subdirectory within the package, without the leading //
+	Query    url.Values      // Query arguments of remote sources (ref, depth, sshkey, archive, ...)
+	Registry *RegistrySource // Parsed registry address, for registry sources
+}
+
+// ParseSource parses a module source address.
+func ParseSource(raw string) (*Source, error) {
+	src := &Source{Raw: raw, Query: url.Values{}}
+
+	// Local paths are never passed to go-getter
+	if isLocalPath(raw) {
+		src.Type = SourceLocal
+		return src, nil
+	}
+
+	// Registry addresses have neither a getter, a scheme nor a query
+	if !strings.Contains(raw, "::") && !strings.Contains(raw, "://") && !strings.ContainsAny(raw, "?@") {
+		if registrySource, err := ParseRegistrySource(raw); err == nil {
+			src.Type, src.Registry, src.Subdir = SourceRegistry, registrySource, registrySource.Subdir
+			return src, nil
+		}
+	}
+
+	// Separate the forced getter, if any
+	forced, address := "", raw
+	if i := strings.Index(raw, "::"); i > 0 && !strings.Contains(raw[:i], "/") {
+		forced, address = raw[:i], raw[i+len("::"):]
+		if _, ok := forcedGetters[forced]; !ok {
+			return nil, fmt.Errorf("unsupported getter '%s' in module source: %s", forced, raw)
+		}
+	}
+
+	// Separate the subdirectory and the query arguments
+	address, src.Subdir = splitSubdir(address)
+	if i := strings.Index(address, "?"); i >= 0 {
+		query, err := url.ParseQuery(address[i+1:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid query in module source %s: %v", raw, err)
+		}
+		address, src.Query = address[:i], query
+	}
+
+	// Expand shorthand addresses to URLs
+	detected, subdir, err := detect(address, forced)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %s", err, raw)
+	}
+	src.Type, src.URL = detected, address
+	if subdir != "" {
+		src.Subdir = strings.TrimPrefix(path.Join(subdir, src.Subdir), "/")
+	}
+
+	switch {
+	case src.Type == SourceGit && shorthandURL(address) != "":
+		src.URL = shorthandURL(address)
+	case src.Type == SourceGit:
+		src.URL = gitURL(address)
+	case !strings.Contains(src.URL, "://"):
+		src.URL = "https://" + src.URL
+	}
+
+	return src, nil
+}
+
+// detect determines the type of a remote address, honoring the forced getter. It also
+// returns the subdirectory implied by shorthand addresses (github.com/org/repo/subdir).
+func detect(address string, forced string) (SourceType, string, error) {
+	if forced != "" {
+		return forcedGetters[forced], shorthandSubdir(address), nil
+	}
+
+	switch {
+	case strings.HasPrefix(address, "github.com/"), strings.HasPrefix(address, "bitbucket.org/"):
+		// Repository shorthands: the path after org/repo is a subdirectory
+		return SourceGit, shorthandSubdir(address), nil
+	case scpLikePattern.MatchString(address) && !strings.Contains(address, "://"):
+		return SourceGit, "", nil
+	case strings.HasPrefix(address, "ssh://"):
+		return SourceGit, "", nil
+	case strings.Contains(address, ".amazonaws.com/") && strings.Contains(address, "s3"):
+		return SourceS3, "", nil
+	case strings.Contains(address, "googleapis.com/storage/"):
+		return SourceGCS, "", nil
+	case strings.HasPrefix(address, "https://"), strings.HasPrefix(address, "http://"):
+		// Plain URLs to .git repositories are cloned, anything else is downloaded
+		if u, err := url.Parse(address); err == nil && strings.HasSuffix(u.Path, ".git") {
+			return SourceGit, "", nil
+		}
+		return SourceHTTP, "", nil
+	case strings.HasPrefix(address, "s3://"):
+		return SourceS3, "", nil
+	case strings.HasPrefix(address, "gs://"):
+		return SourceGCS, "", nil
+	}
+	return "", "", fmt.Errorf("unsupported module source format")
+}
+
+// splitSubdir splits the //subdir part from an address, ignoring the // of a scheme.
+func splitSubdir(address string) (string, string) {
+	offset := 0
+	if i := strings.Index(address, "://"); i >= 0 {
+		offset = i + len("://")
+	}
+
+	i := strings.Index(address[offset:], "//")
+	if i < 0 {
+		return address, ""
+	}
+	i += offset
+
+	// The query belongs to the address, not to the subdirectory
+	subdir, query := address[i+len("//"):], ""
+	if j := strings.Index(subdir, "?"); j >= 0 {
+		subdir, query = subdir[:j], subdir[j:]
+	}
+	return address[:i] + query, subdir
+}
+
+// shorthandSubdir returns the path after org/repo of a github.com or bitbucket.org
+// shorthand address.
+func shorthandSubdir(address string) string {
+	if !strings.HasPrefix(address, "github.com/") && !strings.HasPrefix(address, "bitbucket.org/") {
+		return ""
+	}
+	parts := strings.SplitN(address, "/", 4)
+	if len(parts) < 4 {
+		return ""
+	}
+	return parts[3]
+}
+
+// shorthandURL expands a github.com or bitbucket.org shorthand address to its
+// HTTPS clone URL, or returns an empty string for other addresses.
+func shorthandURL(address string) string {
+	if !strings.HasPrefix(address, "github.com/") && !strings.HasPrefix(address, "bitbucket.org/") {
+		return ""
+	}
+	parts := strings.SplitN(address, "/", 4)
+	if len(parts) < 3 {
+		return ""
+	}
+	return "https://" + parts[0] + "/" + parts[1] + "/" + strings.TrimSuffix(parts[2], ".git") + ".git"
+}
+
+// gitURL converts an SCP-like Git address (git@github.com:org/repo.git) to an ssh://
+// URL. Other addresses are returned unchanged.
+func gitURL(address string) string {
+	if strings.Contains(address, "://") {
+		return address
+	}
+	if match := scpLikePattern.FindStringSubmatch(address); match != nil {
+		return "ssh://" + match[1] + match[2] + "/" + match[3]
+	}
+	return address
+}
+
+// isLocalPath checks if a source is a local path.
+func isLocalPath(source string) bool {
+	for _, prefix := range []string{"./", "../", ".\\", "..\\"} {
+		if strings.HasPrefix(source, prefix) {
+			return true
+		}
+	}
+	return source == "." || source == ".."
+}
+
+// Versioned reports whether versions of the source can be looked up: registry
+// addresses by their registry, Git repositories by their tags.
+func (s *Source) Versioned() bool {
+	return s.Type == SourceRegistry || s.Type == SourceGit
+}
+
+// Ref returns the Git ref of the source (?ref=), if any.
+func (s *Source) Ref() string {
+	return s.Query.Get("ref")
+}
+
+// Address returns the address the versions of the source are looked up by, shared by
+// every source of the same package: the registry address without subdirectory, or
+// the Git clone URL with the git:: getter.
+func (s *Source) Address() string {
+	switch s.Type {
+	case SourceRegistry:
+		address, _ := splitSubdir(s.Raw)
+		return address
+	case SourceLocal:
+		return s.Raw
+	}
+	return string(s.Type) + "::" + s.URL
+}
+
+// refEscaper escapes the characters of a tag name that would end or alter a query
+// argument. Slashes are kept, so that prefixed tags stay readable.
+var refEscaper = strings.NewReplacer("%", "%25", "&", "%26", "#", "%23", "+", "%2B", " ", "%20")
+
+// replaceRef returns a Git source with its ref query argument set to ref. Everything
+// else (getter, scheme, subdirectory, other query arguments) is kept as written. A ref
+// is added to sources without one.
+func replaceRef(source string, ref string) string {
+	value := refEscaper.Replace(ref)
+
+	i := strings.Index(source, "?")
+	if i < 0 {
+		return source + "?ref=" + value
+	}
+
+	params := strings.Split(source[i+1:], "&")
+	for j, param := range params {
+		if key, _, _ := strings.Cut(param, "="); key == "ref" {
+			params[j] = "ref=" + value
+			return source[:i+1] + strings.Join(params, "&")
+		}
+	}
+	return source + "&ref=" + value
+}
+
+// removeRef returns a source without its ref query argument.
+func removeRef(source string) string {
+	i := strings.Index(source, "?")
+	if i < 0 {
+		return source
+	}
+
+	var params []string
+	for _, param := range strings.Split(source[i+1:], "&") {
+		if key, _, _ := strings.Cut(param, "="); key != "ref" {
+			params = append(params, param)
+		}
+	}
+	if len(params) == 0 {
+		return source[:i]
+	}
+	return source[:i+1] + strings.Join(params, "&")
+}
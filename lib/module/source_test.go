@@ -0,0 +1,74 @@
+package module
+
+import "testing"
+
+func TestParseSource(t *testing.T) {
+	tests := []struct {
+		raw     string
+		typ     SourceType
+		url     string
+		subdir  string
+		ref     string
+		address string
+	}{
+		{"./modules/network", SourceLocal, "", "", "", "./modules/network"},
+		{"..", SourceLocal, "", "", "", ".."},
+		{"terraform-aws-modules/vpc/aws", SourceRegistry, "", "", "", "terraform-aws-modules/vpc/aws"},
+		{"app.terraform.io/acme/vpc/aws//modules/subnet", SourceRegistry, "", "modules/subnet", "", "app.terraform.io/acme/vpc/aws"},
+		{"github.com/org/repo", SourceGit, "https://github.com/org/repo.git", "", "", "git::https://github.com/org/repo.git"},
+		{"github.com/org/repo/modules/x?ref=v1.2.0", SourceGit, "https://github.com/org/repo.git", "modules/x", "v1.2.0", "git::https://github.com/org/repo.git"},
+		{"bitbucket.org/org/repo.git", SourceGit, "https://bitbucket.org/org/repo.git", "", "", "git::https://bitbucket.org/org/repo.git"},
+		{"git::https://example.com/org/repo.git//modules/x?ref=v1.2.0&depth=1", SourceGit, "https://example.com/org/repo.git", "modules/x", "v1.2.0", "git::https://example.com/org/repo.git"},
+		{"git@github.com:org/repo.git?ref=v1.0.0", SourceGit, "ssh://git@github.com/org/repo.git", "", "v1.0.0", "git::ssh://git@github.com/org/repo.git"},
+		{"git::ssh://git@example.com/org/repo.git", SourceGit, "ssh://git@example.com/org/repo.git", "", "", "git::ssh://git@example.com/org/repo.git"},
+		{"https://example.com/org/repo.git?ref=main", SourceGit, "https://example.com/org/repo.git", "", "main", "git::https://example.com/org/repo.git"},
+		{"https://example.com/vpc-module.zip", SourceHTTP, "https://example.com/vpc-module.zip", "", "", "http::https://example.com/vpc-module.zip"},
+		{"hg::http://example.com/vpc.hg", SourceHg, "http://example.com/vpc.hg", "", "", "hg::http://example.com/vpc.hg"},
+		{"s3::https://s3-eu-west-1.amazonaws.com/bucket/vpc.zip", SourceS3, "https://s3-eu-west-1.amazonaws.com/bucket/vpc.zip", "", "", "s3::https://s3-eu-west-1.amazonaws.com/bucket/vpc.zip"},
+		{"gcs::https://www.googleapis.com/storage/v1/bucket/vpc.zip", SourceGCS, "https://www.googleapis.com/storage/v1/bucket/vpc.zip", "", "", "gcs::https://www.googleapis.com/storage/v1/bucket/vpc.zip"},
+	}
+	for _, test := range tests {
+		src, err := ParseSource(test.raw)
+		if err != nil {
+			t.Errorf("ParseSource(%q) returned an error: %v", test.raw, err)
+			continue
+		}
+		if src.Type != test.typ || src.URL != test.url || src.Subdir != test.subdir || src.Ref() != test.ref {
+			t.Errorf("ParseSource(%q) = {%s %q %q ref=%q}, want {%s %q %q ref=%q}",
+				test.raw, src.Type, src.URL, src.Subdir, src.Ref(), test.typ, test.url, test.subdir, test.ref)
+		}
+		if got := src.Address(); got != test.address {
+			t.Errorf("ParseSource(%q).Address() = %q, want %q", test.raw, got, test.address)
+		}
+	}
+}
+
+func TestParseSourceErrors(t *testing.T) {
+	for _, raw := range []string{"svn::https://example.com/repo", "not a source", "git::https://example.com/repo?ref=%zz"} {
+		if src, err := ParseSource(raw); err == nil {
+			t.Errorf("ParseSource(%q) = %+v, want an error", raw, src)
+		}
+	}
+}
+
+func TestReplaceRef(t *testing.T) {
+	tests := []struct {
+		source string
+		ref    string
+		want   string
+	}{
+		{"git::https://example.com/repo.git?ref=v1.0.0", "v1.2.0", "git::https://example.com/repo.git?ref=v1.2.0"},
+		{"git::https://example.com/repo.git//modules/x?depth=1&ref=v1.0.0", "v1.2.0", "git::https://example.com/repo.git//modules/x?depth=1&ref=v1.2.0"},
+		{"git::https://example.com/repo.git?ref=v1.0.0&depth=1", "v1.2.0", "git::https://example.com/repo.git?ref=v1.2.0&depth=1"},
+		{"github.com/org/repo", "v1.2.0", "github.com/org/repo?ref=v1.2.0"},
+		{"git@github.com:org/repo.git?depth=1", "v1.2.0", "git@github.com:org/repo.git?depth=1&ref=v1.2.0"},
+		{"git::https://example.com/repo.git?reference=x", "v1.2.0", "git::https://example.com/repo.git?reference=x&ref=v1.2.0"},
+		{"git::https://example.com/repo.git?ref=network/v1.0.0", "network/v1.2.0", "git::https://example.com/repo.git?ref=network/v1.2.0"},
+		{"git::https://example.com/repo.git?ref=v1.0.0", "v1.2.0+build&1", "git::https://example.com/repo.git?ref=v1.2.0%2Bbuild%261"},
+	}
+	for _, test := range tests {
+		if got := replaceRef(test.source, test.ref); got != test.want {
+			t.Errorf("replaceRef(%q, %q) = %q, want %q", test.source, test.ref, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package module
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// versionPattern matches a version at the end of a Git tag, e.g. v1.4.0 or 2.1.0-rc1.
+const versionPattern = `v?[0-9]+(?:\.[0-9]+)*(?:-[0-9A-Za-z.-]+)?(?:\+[0-9A-Za-z.-]+)?`
+
+// refPattern splits a Git ref into a prefix and a trailing version, e.g.
+// network/v1.4.0 into network/ and v1.4.0, or modules/gke-v2.1.0 into modules/gke- and v2.1.0.
+var refPattern = regexp.MustCompile(`^(.*?)(` + versionPattern + `)$`)
+
+// TagPattern returns the regular expression selecting the tags that version a Git
+// module, with the version in its first capture group. Configured patterns are keyed
+// by module source or repository address; a repository address applies to every
+// module of the repository. Otherwise the pattern is inferred from the prefix of the
+// current ref (network/v1.4.0 selects network/*); refs without a prefix and commit
+// SHAs select every tag and return an empty pattern.
+func TagPattern(source string, ref string, configured map[string]string) string {
+	// Configured patterns match the source as written, without its ref, or its repository
+	if pattern, ok := configured[removeRef(source)]; ok {
+		return pattern
+	}
+	if pattern, ok := configured[source]; ok {
+		return pattern
+	}
+	if src, err := ParseSource(source); err == nil {
+		keys := make([]string, 0, len(configured))
+		for key := range configured {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			// Keys with a subdirectory only apply to the modules in that subdirectory
+			keySource, err := ParseSource(key)
+			if err == nil && keySource.Address() == src.Address() && (keySource.Subdir == "" || keySource.Subdir == src.Subdir) {
+				return configured[key]
+			}
+		}
+	}
+
+	// Infer the pattern from the prefix of the current ref; commits have no prefix
+	if IsCommitSHA(ref) {
+		return ""
+	}
+	match := refPattern.FindStringSubmatch(ref)
+	if match == nil || match[1] == "" {
+		return ""
+	}
+	return "^" + regexp.QuoteMeta(match[1]) + "(.+)$"
+}
+
+// ValidateTagPattern checks that a tag pattern compiles and captures the version.
+func ValidateTagPattern(pattern string) error {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return fmt.Errorf("invalid tag pattern '%s': %v", pattern, err)
+	}
+	if re.NumSubexp() < 1 {
+		return fmt.Errorf("tag pattern '%s' has no capture group for the version", pattern)
+	}
+	return nil
+}
+
+// TaggedAddress returns the address the versions of a Git module are looked up by
+// when only the tags matching a pattern are considered: <repository>#<pattern>.
+func TaggedAddress(address string, pattern string) string {
+	if pattern == "" {
+		return address
+	}
+	return address + "#" + pattern
+}
+
+// splitTaggedAddress splits a tagged address into the source address and the pattern.
+func splitTaggedAddress(address string) (string, string) {
+	if i := strings.Index(address, "#"); i >= 0 {
+		return address[:i], address[i+1:]
+	}
+	return address, ""
+}
+
+// TagVersion returns the version part of a Git ref selected by a tag pattern, or the
+// ref itself when there is no pattern or the ref does not match it.
+func TagVersion(ref string, pattern string) string {
+	if pattern == "" {
+		return ref
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return ref
+	}
+	if match := re.FindStringSubmatch(ref); match != nil {
+		return match[1]
+	}
+	return ref
+}
+
+// TagName returns the tag to write as ref for a version selected by a tag pattern,
+// keeping the prefix (and suffix) of the current ref.
+func TagName(ref string, pattern string, version string) string {
+	if pattern == "" {
+		return version
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return version
+	}
+
+	// Replace the version part of the current ref
+	if match := re.FindStringSubmatchIndex(ref); match != nil && match[2] >= 0 {
+		return ref[:match[2]] + version + ref[match[3]:]
+	}
+
+	// Without a matching ref, use the literal prefix of the pattern
+	prefix, _ := re.LiteralPrefix()
+	return prefix + version
+}
+
+// matchTag returns the version part of a tag selected by a tag pattern.
+func matchTag(re *regexp.Regexp, tag string) (string, bool) {
+	if re == nil {
+		return tag, true
+	}
+	match := re.FindStringSubmatch(tag)
+	if match == nil {
+		return "", false
+	}
+	return match[1], true
+}
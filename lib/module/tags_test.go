@@ -0,0 +1,106 @@
+package module
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestTagPattern(t *testing.T) {
+	configured := map[string]string{
+		"git::https://example.com/mono.git":            `^mono-(.+)$`,
+		"git::https://example.com/sub.git//modules/db": `^db-(.+)$`,
+		"github.com/org/exact?depth=1":                 `^exact-(.+)$`,
+	}
+	tests := []struct {
+		source string
+		ref    string
+		want   string
+	}{
+		{"git::https://example.com/repo.git?ref=v1.4.0", "v1.4.0", ""},
+		{"git::https://example.com/repo.git?ref=network/v1.4.0", "network/v1.4.0", `^network/(.+)$`},
+		{"git::https://example.com/repo.git?ref=modules/gke-v2.1.0", "modules/gke-v2.1.0", `^modules/gke-(.+)$`},
+		{"git::https://example.com/repo.git?ref=a.b+c-1.0.0", "a.b+c-1.0.0", `^a\.b\+c-(.+)$`},
+		{"git::https://example.com/repo.git?ref=0123456789abcdef0123456789abcdef01234567", "0123456789abcdef0123456789abcdef01234567", ""},
+		{"git::https://example.com/repo.git?ref=main", "main", ""},
+		{"git::https://example.com/mono.git//modules/vpc?ref=v1.0.0", "v1.0.0", `^mono-(.+)$`},
+		{"git::https://example.com/sub.git//modules/db?ref=v1.0.0", "v1.0.0", `^db-(.+)$`},
+		{"git::https://example.com/sub.git//modules/vpc?ref=v1.0.0", "v1.0.0", ""},
+		{"github.com/org/exact?depth=1&ref=v1.0.0", "v1.0.0", `^exact-(.+)$`},
+	}
+	for _, test := range tests {
+		if got := TagPattern(test.source, test.ref, configured); got != test.want {
+			t.Errorf("TagPattern(%q, %q) = %q, want %q", test.source, test.ref, got, test.want)
+		}
+	}
+}
+
+func TestTagName(t *testing.T) {
+	tests := []struct {
+		ref     string
+		pattern string
+		version string
+		want    string
+	}{
+		{"v1.4.0", "", "v1.6.0", "v1.6.0"},
+		{"network/v1.4.0", `^network/(.+)$`, "v1.6.0", "network/v1.6.0"},
+		{"modules/gke-v2.1.0", `^modules/gke-(.+)$`, "v2.3.0", "modules/gke-v2.3.0"},
+		{"release-1.0.0-final", `^release-([0-9.]+)-final$`, "1.2.0", "release-1.2.0-final"},
+		{"main", `^network/(.+)$`, "v1.6.0", "network/v1.6.0"},
+	}
+	for _, test := range tests {
+		if got := TagName(test.ref, test.pattern, test.version); got != test.want {
+			t.Errorf("TagName(%q, %q, %q) = %q, want %q", test.ref, test.pattern, test.version, got, test.want)
+		}
+
+		// The written tag is selected by the pattern again, with the same version
+		if test.pattern != "" {
+			if version, ok := matchTag(regexp.MustCompile(test.pattern), TagName(test.ref, test.pattern, test.version)); !ok || version != test.version {
+				t.Errorf("TagName(%q, %q, %q) is not matched back to its version", test.ref, test.pattern, test.version)
+			}
+		}
+	}
+}
+
+func TestTagVersion(t *testing.T) {
+	tests := []struct {
+		ref     string
+		pattern string
+		want    string
+	}{
+		{"v1.4.0", "", "v1.4.0"},
+		{"network/v1.4.0", `^network/(.+)$`, "v1.4.0"},
+		{"main", `^network/(.+)$`, "main"},
+	}
+	for _, test := range tests {
+		if got := TagVersion(test.ref, test.pattern); got != test.want {
+			t.Errorf("TagVersion(%q, %q) = %q, want %q", test.ref, test.pattern, got, test.want)
+		}
+	}
+}
+
+func TestValidateTagPattern(t *testing.T) {
+	if err := ValidateTagPattern(`^network/(.+)$`); err != nil {
+		t.Errorf("ValidateTagPattern returned an error: %v", err)
+	}
+	for _, pattern := range []string{`^network/.+$`, `^network/(.+$`} {
+		if err := ValidateTagPattern(pattern); err == nil {
+			t.Errorf("ValidateTagPattern(%q) returned no error", pattern)
+		}
+	}
+}
+
+func TestRemoveRef(t *testing.T) {
+	tests := []struct {
+		source string
+		want   string
+	}{
+		{"git::https://example.com/repo.git?ref=v1.0.0", "git::https://example.com/repo.git"},
+		{"git::https://example.com/repo.git?depth=1&ref=v1.0.0", "git::https://example.com/repo.git?depth=1"},
+		{"github.com/org/repo", "github.com/org/repo"},
+	}
+	for _, test := range tests {
+		if got := removeRef(test.source); got != test.want {
+			t.Errorf("removeRef(%q) = %q, want %q", test.source, got, test.want)
+		}
+	}
+}
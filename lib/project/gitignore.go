@@ -0,0 +1,100 @@
+package project
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/format/gitignore"
+)
+
+// ignorer tells the paths ignored by Git under the directories searched. The patterns
+// of the .gitignore of each directory are loaded when the directory is entered, as Git
+// scopes them to the directory.
+type ignorer struct {
+	repo     string // Root of the Git repository, absolute
+	patterns []gitignore.Pattern
+}
+
+// newIgnorer loads the ignore patterns of the repository a directory belongs to, down
+// to the parent of the directory. It returns nil when the directory is not in a Git
+// repository.
+func newIgnorer(dir string) *ignorer {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil
+	}
+
+	// Find the root of the repository
+	repo := dir
+	for {
+		if _, err := os.Stat(filepath.Join(repo, ".git")); err == nil {
+			break
+		}
+		parent := filepath.Dir(repo)
+		if parent == repo {
+			return nil
+		}
+		repo = parent
+	}
+
+	// Load the repository excludes and the .gitignore of every parent directory
+	i := &ignorer{repo: repo}
+	i.load(filepath.Join(repo, ".git", "info", "exclude"), nil)
+	for current := repo; current != dir; {
+		i.enter(current)
+		rel, _ := filepath.Rel(current, dir)
+		current = filepath.Join(current, strings.Split(filepath.ToSlash(rel), "/")[0])
+	}
+	return i
+}
+
+// enter loads the .gitignore of a directory about to be searched.
+func (i *ignorer) enter(dir string) {
+	i.load(filepath.Join(dir, ".gitignore"), i.split(dir))
+}
+
+// ignored reports whether Git ignores a path.
+func (i *ignorer) ignored(path string, isDir bool) bool {
+	segments := i.split(path)
+	if segments == nil {
+		return false
+	}
+	return gitignore.NewMatcher(i.patterns).Match(segments, isDir)
+}
+
+// split returns the segments of a path relative to the root of the repository, or nil
+// when the path is outside the repository.
+func (i *ignorer) split(path string) []string {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil
+	}
+	rel, err := filepath.Rel(i.repo, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return nil
+	}
+	if rel == "." {
+		return []string{}
+	}
+	return strings.Split(filepath.ToSlash(rel), "/")
+}
+
+// load appends the patterns of an ignore file, scoped to a directory of the repository.
+// Missing files are skipped.
+func (i *ignorer) load(file string, domain []string) {
+	f, err := os.Open(file)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "#") && strings.TrimSpace(line) != "" {
+			i.patterns = append(i.patterns, gitignore.ParsePattern(line, domain))
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package project
+
+import (
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// match reports whether a path, or one of its parent directories, matches a pattern.
+// Patterns use the path.Match syntax on each segment, plus ** for any number of
+// segments (envs/**/main.tf). A pattern without a slash matches the name of any segment
+// (.terraform, *.tofu), like in a .gitignore.
+func match(pattern string, name string) bool {
+	pattern = strings.TrimPrefix(strings.TrimSuffix(pattern, "/"), "./")
+	segments := strings.Split(filepath.ToSlash(filepath.Clean(name)), "/")
+	if !strings.Contains(pattern, "/") {
+		for _, segment := range segments {
+			if matched, _ := path.Match(pattern, segment); matched {
+				return true
+			}
+		}
+		return false
+	}
+	return matchSegments(strings.Split(pattern, "/"), segments)
+}
+
+// matchSegments reports whether the segments of a pattern match the first segments of
+// a path.
+func matchSegments(pattern []string, segments []string) bool {
+	if len(pattern) == 0 {
+		return true
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(segments); i++ {
+			if matchSegments(pattern[1:], segments[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(segments) == 0 {
+		return false
+	}
+	matched, _ := path.Match(pattern[0], segments[0])
+	return matched && matchSegments(pattern[1:], segments[1:])
+}
+
+// isPattern reports whether a path argument is a glob pattern rather than a path.
+func isPattern(arg string) bool {
+	return strings.ContainsAny(arg, "*?[")
+}
+
+// patternBase returns the directory to search for the matches of a pattern: its
+// segments before the first one with a wildcard.
+func patternBase(pattern string) string {
+	var base []string
+	for _, segment := range strings.Split(filepath.ToSlash(pattern), "/") {
+		if isPattern(segment) {
+			break
+		}
+		base = append(base, segment)
+	}
+	if len(base) == 0 {
+		return "."
+	}
+	if len(base) == 1 && base[0] == "" {
+		return "/"
+	}
+	return filepath.FromSlash(strings.Join(base, "/"))
+}
@@ -0,0 +1,65 @@
+package project
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		name    string
+		want    bool
+	}{
+		{".terraform", "envs/prod/.terraform/modules/main.tf", true},
+		{".terraform", "envs/prod/main.tf", false},
+		{"*.tofu", "envs/prod/main.tofu", true},
+		{"*.tofu", "envs/prod/main.tf", false},
+		{"envs/**/main.tf", "envs/prod/eu/main.tf", true},
+		{"envs/**/main.tf", "envs/main.tf", true},
+		{"envs/**/main.tf", "modules/main.tf", false},
+		{"envs/*/main.tf", "envs/prod/eu/main.tf", false},
+		{"envs/prod", "envs/prod/main.tf", true},
+		{"envs/prod/", "envs/prod/main.tf", true},
+		{"./envs/prod", "envs/prod/main.tf", true},
+		{"envs/prod", "envs/production/main.tf", false},
+		{"envs/pro?", "envs/prod/main.tf", true},
+		{"envs/[ps]*", "envs/staging/main.tf", true},
+		{"**/modules", "a/b/modules/vpc/main.tf", true},
+		{"/repo/envs/**", "/repo/envs/prod/main.tf", true},
+		{"envs/prod", "./envs/prod/main.tf", true},
+	}
+	for _, test := range tests {
+		if got := match(test.pattern, filepath.FromSlash(test.name)); got != test.want {
+			t.Errorf("match(%q, %q) = %v, want %v", test.pattern, test.name, got, test.want)
+		}
+	}
+}
+
+func TestPatternBase(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    string
+	}{
+		{"envs/**/main.tf", "envs"},
+		{"envs/prod/*.tf", "envs/prod"},
+		{"**/main.tf", "."},
+		{"*.tf", "."},
+		{"/repo/envs/**", "/repo/envs"},
+		{"/*/main.tf", "/"},
+		{"envs/prod-[0-9]/main.tf", "envs"},
+	}
+	for _, test := range tests {
+		if got := patternBase(test.pattern); got != filepath.FromSlash(test.want) {
+			t.Errorf("patternBase(%q) = %q, want %q", test.pattern, got, test.want)
+		}
+	}
+}
+
+func TestIsPattern(t *testing.T) {
+	for arg, want := range map[string]bool{"envs/**": true, "main.?f": true, "[ab]": true, "envs/prod": false, "./...": false} {
+		if got := isPattern(arg); got != want {
+			t.Errorf("isPattern(%q) = %v, want %v", arg, got, want)
+		}
+	}
+}
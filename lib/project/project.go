@@ -0,0 +1,268 @@
+package project
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"tfau/lib/hcl"
+	"tfau/lib/lockfile"
+	"tfau/lib/module"
+)
+
+// Exclude are the patterns of the files and directories never searched, configured by
+// the CLI (see match). Relative patterns are matched relative to the working directory.
+var Exclude = []string{".terraform", ".git", ".terragrunt-cache", "node_modules"}
+
+// Include are the patterns of the files searched, configured by the CLI; every .tf and
+// .tofu file is searched when empty.
+var Include []string
+
+// GitIgnore tells whether the files and directories ignored by Git are skipped.
+var GitIgnore = true
+
+// Module is a Terraform module: the .tf and .tofu files of a directory, which Terraform
+// reads as a single configuration.
+type Module struct {
+	Dir   string   // Directory of the module
+	Files []string // Files of the module, sorted
+	Root  bool     // Whether terraform runs in the module rather than calling it
+	Calls []string // Directories of the local child modules it calls (./modules/x)
+}
+
+// Project is the set of modules tfau works on.
+type Project struct {
+	Modules []*Module // Modules sorted by directory
+
+	byDir map[string]*Module
+}
+
+// Find returns the files of every module under the given paths: directories are
+// searched recursively (dir/... too), glob patterns with ** search the directory before
+// their first wildcard for the paths they match, and files are taken as is. Searched
+// paths are filtered by Include, Exclude and the .gitignore files.
+func Find(paths ...string) ([]string, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get current working directory: %v", err)
+	}
+
+	var files []string
+	for _, arg := range paths {
+		arg = strings.TrimSuffix(filepath.ToSlash(arg), "/...")
+		root, pattern := filepath.FromSlash(arg), ""
+		if isPattern(arg) {
+			root, pattern = patternBase(arg), arg
+		}
+
+		// Files named explicitly are never filtered
+		info, err := os.Stat(root)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find %s: %v", arg, err)
+		}
+		if !info.IsDir() {
+			if pattern == "" {
+				files = append(files, root)
+			}
+			continue
+		}
+
+		found, err := search(cwd, root, pattern)
+		if err != nil {
+			return nil, fmt.Errorf("failed to search %s: %v", arg, err)
+		}
+		files = append(files, found...)
+	}
+	return files, nil
+}
+
+// search walks a directory for the .tf and .tofu files matching a pattern, if any, and
+// the Include patterns, skipping the Exclude patterns and the paths ignored by Git.
+func search(cwd string, root string, pattern string) ([]string, error) {
+	var ignore *ignorer
+	if GitIgnore {
+		ignore = newIgnorer(root)
+	}
+
+	var files []string
+	err := filepath.WalkDir(root, func(path string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path != root && (excluded(cwd, path) || ignore != nil && ignore.ignored(path, entry.IsDir())) {
+			log.Printf("Skipping %s", path)
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if entry.IsDir() {
+			if ignore != nil {
+				ignore.enter(path)
+			}
+			return nil
+		}
+		if ext := filepath.Ext(path); ext != ".tf" && ext != ".tofu" {
+			return nil
+		}
+		if (pattern == "" || match(pattern, path)) && included(cwd, path) {
+			files = append(files, path)
+		}
+		return nil
+	})
+	return files, err
+}
+
+// Load groups files into modules by directory and tells root modules from child
+// modules. A module called by another module of the project through a local path is a
+// child module, unless it has a lock file; every other module is a root module.
+func Load(files []string) *Project {
+	p := &Project{byDir: make(map[string]*Module)}
+	seen := make(map[string]bool)
+	for _, file := range files {
+		// Overlapping paths find the same files
+		if seen[filepath.Clean(file)] {
+			continue
+		}
+		seen[filepath.Clean(file)] = true
+
+		dir := filepath.Clean(filepath.Dir(file))
+		m, exists := p.byDir[dir]
+		if !exists {
+			m = &Module{Dir: dir}
+			p.byDir[dir] = m
+			p.Modules = append(p.Modules, m)
+		}
+		m.Files = append(m.Files, file)
+	}
+	sort.Slice(p.Modules, func(i, j int) bool {
+		return p.Modules[i].Dir < p.Modules[j].Dir
+	})
+
+	// Find the local child modules called by each module
+	called := make(map[string]bool)
+	for _, m := range p.Modules {
+		sort.Strings(m.Files)
+		m.Calls = localCalls(m)
+		for _, dir := range m.Calls {
+			called[dir] = true
+		}
+	}
+	for _, m := range p.Modules {
+		m.Root = !called[m.Dir] || hasLockFile(m.Dir)
+	}
+
+	return p
+}
+
+// Module returns the module of a directory, or nil when it is not part of the project.
+func (p *Project) Module(dir string) *Module {
+	return p.byDir[filepath.Clean(dir)]
+}
+
+// Roots returns the root modules of the project.
+func (p *Project) Roots() []*Module {
+	var roots []*Module
+	for _, m := range p.Modules {
+		if m.Root {
+			roots = append(roots, m)
+		}
+	}
+	return roots
+}
+
+// Tree returns a module and every local child module of the project it calls,
+// directly or through other child modules.
+func (p *Project) Tree(m *Module) []*Module {
+	var tree []*Module
+	visited := make(map[string]bool)
+	pending := []*Module{m}
+	for len(pending) > 0 {
+		current := pending[0]
+		pending = pending[1:]
+		if visited[current.Dir] {
+			continue
+		}
+		visited[current.Dir] = true
+		tree = append(tree, current)
+		for _, dir := range current.Calls {
+			if child := p.Module(dir); child != nil {
+				pending = append(pending, child)
+			}
+		}
+	}
+	return tree
+}
+
+// localCalls returns the directories of the local child modules a module calls.
+// Files that cannot be parsed are skipped; they are reported when processed.
+func localCalls(m *Module) []string {
+	var dirs []string
+	for _, file := range m.Files {
+		doc, err := hcl.Load(file)
+		if err != nil {
+			continue
+		}
+		calls, err := module.Extract(doc.Content)
+		if err != nil {
+			continue
+		}
+		for _, call := range calls {
+			if src, err := module.ParseSource(call["source"]); err == nil && src.Type == module.SourceLocal {
+				dirs = append(dirs, filepath.Clean(filepath.Join(m.Dir, call["source"])))
+			}
+		}
+	}
+	sort.Strings(dirs)
+	return dirs
+}
+
+// hasLockFile reports whether a directory has a dependency lock file, which only
+// terraform init in a root module writes.
+func hasLockFile(dir string) bool {
+	_, err := os.Stat(filepath.Join(dir, lockfile.Filename))
+	return err == nil
+}
+
+// excluded reports whether a path matches one of the Exclude patterns.
+func excluded(cwd string, path string) bool {
+	for _, pattern := range Exclude {
+		if matchPath(cwd, pattern, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// included reports whether a file matches one of the Include patterns, if any.
+func included(cwd string, path string) bool {
+	if len(Include) == 0 {
+		return true
+	}
+	for _, pattern := range Include {
+		if matchPath(cwd, pattern, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchPath reports whether a path matches a pattern. Relative patterns are written
+// relative to the working directory, absolute patterns match the absolute path.
+func matchPath(cwd string, pattern string, path string) bool {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return match(pattern, path)
+	}
+	if filepath.IsAbs(pattern) {
+		return match(pattern, abs)
+	}
+	rel, err := filepath.Rel(cwd, abs)
+	if err != nil {
+		return match(pattern, path)
+	}
+	return match(pattern, rel)
+}
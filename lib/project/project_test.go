@@ -0,0 +1,155 @@
+package project
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// writeProject writes two root modules calling a shared network module, the prod one
+// through an app module with a lock file, and a module installed by terraform init.
+func writeProject(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	files := map[string]string{
+		"envs/prod/main.tf": `module "app" {
+  source = "../../modules/app"
+}
+
+module "network" {
+  source = "../../modules/network"
+}
+`,
+		"envs/dev/main.tf": `module "network" {
+  source = "../../modules/network"
+}
+`,
+		"envs/dev/.terraform/modules/network/main.tf": `variable "cidr" {}
+`,
+		"modules/app/main.tf": `module "network" {
+  source = "../network"
+}
+`,
+		"modules/app/.terraform.lock.hcl": ``,
+		"modules/network/main.tf": `variable "cidr" {}
+`,
+		"modules/network/outputs.tf": `output "id" {
+  value = "network"
+}
+`,
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// withoutGitIgnore disables the .gitignore files for the duration of a test.
+func withoutGitIgnore(t *testing.T) {
+	t.Helper()
+	previous := GitIgnore
+	GitIgnore = false
+	t.Cleanup(func() { GitIgnore = previous })
+}
+
+func TestFind(t *testing.T) {
+	withoutGitIgnore(t)
+	dir := writeProject(t)
+
+	files, err := Find(dir)
+	if err != nil {
+		t.Fatalf("Find error: %v", err)
+	}
+	want := []string{
+		filepath.Join(dir, "envs", "dev", "main.tf"),
+		filepath.Join(dir, "envs", "prod", "main.tf"),
+		filepath.Join(dir, "modules", "app", "main.tf"),
+		filepath.Join(dir, "modules", "network", "main.tf"),
+		filepath.Join(dir, "modules", "network", "outputs.tf"),
+	}
+	if !reflect.DeepEqual(files, want) {
+		t.Errorf("Find = %v, want %v", files, want)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	withoutGitIgnore(t)
+	dir := writeProject(t)
+	files, err := Find(dir)
+	if err != nil {
+		t.Fatalf("Find error: %v", err)
+	}
+	p := Load(append(files, files[0]))
+
+	var dirs []string
+	for _, m := range p.Modules {
+		dirs = append(dirs, m.Dir)
+	}
+	network := filepath.Join(dir, "modules", "network")
+	wantDirs := []string{
+		filepath.Join(dir, "envs", "dev"),
+		filepath.Join(dir, "envs", "prod"),
+		filepath.Join(dir, "modules", "app"),
+		network,
+	}
+	if !reflect.DeepEqual(dirs, wantDirs) {
+		t.Fatalf("Load modules = %v, want %v", dirs, wantDirs)
+	}
+	if m := p.Module(filepath.Join(dir, "envs", "dev")); m == nil || len(m.Files) != 1 {
+		t.Errorf("Load did not skip the file given twice: %+v", m)
+	}
+	if m := p.Module(network); m == nil || len(m.Files) != 2 {
+		t.Errorf("Load did not group the files of %s: %+v", network, m)
+	}
+
+	// A called module is a child module, unless it has a lock file
+	var roots []string
+	for _, m := range p.Roots() {
+		roots = append(roots, m.Dir)
+	}
+	wantRoots := wantDirs[:3]
+	if !reflect.DeepEqual(roots, wantRoots) {
+		t.Errorf("Roots = %v, want %v", roots, wantRoots)
+	}
+}
+
+func TestTree(t *testing.T) {
+	withoutGitIgnore(t)
+	dir := writeProject(t)
+	files, err := Find(dir)
+	if err != nil {
+		t.Fatalf("Find error: %v", err)
+	}
+	p := Load(files)
+
+	// The network module belongs to the tree of both root modules, once
+	tests := []struct {
+		root string
+		want []string
+	}{
+		{"envs/dev", []string{"envs/dev", "modules/network"}},
+		{"envs/prod", []string{"envs/prod", "modules/app", "modules/network"}},
+		{"modules/network", []string{"modules/network"}},
+	}
+	for _, tt := range tests {
+		m := p.Module(filepath.Join(dir, filepath.FromSlash(tt.root)))
+		if m == nil {
+			t.Fatalf("Module(%s) = nil", tt.root)
+		}
+		var tree []string
+		for _, child := range p.Tree(m) {
+			rel, _ := filepath.Rel(dir, child.Dir)
+			tree = append(tree, filepath.ToSlash(rel))
+		}
+		if !reflect.DeepEqual(tree, tt.want) {
+			t.Errorf("Tree(%s) = %v, want %v", tt.root, tree, tt.want)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package provider
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	neturl "net/url"
+	"strings"
+
+	"tfau/lib/httpcache"
+	"tfau/lib/registry"
+)
+
+// Package represents the response from the provider registry API describing the
+// package of a provider version for a platform.
+type Package struct {
+	OS                  string `json:"os"`
+	Arch                string `json:"arch"`
+	Filename            string `json:"filename"`
+	DownloadURL         string `json:"download_url"`
+	SHASumsURL          string `json:"shasums_url"`
+	SHASumsSignatureURL string `json:"shasums_signature_url"`
+	SHASum              string `json:"shasum"`
+	SigningKeys         struct {
+		GPGPublicKeys []struct {
+			KeyID      string `json:"key_id"`
+			ASCIIArmor string `json:"ascii_armor"`
+		} `json:"gpg_public_keys"`
+	} `json:"signing_keys"`
+}
+
+// Address returns the fully qualified address of a provider source, as used in
+// dependency lock files: registry.terraform.io/hashicorp/aws.
+func Address(source string) (string, error) {
+	host, path, err := splitSource(source)
+	if err != nil {
+		return "", err
+	}
+	return host + "/" + strings.ToLower(path), nil
+}
+
+// GetPackage fetches the package metadata of a provider version for a platform
+// (<os>_<arch>, e.g. linux_amd64) from its registry.
+func GetPackage(source string, providerVersion string, platform string) (*Package, error) {
+	host, path, err := splitSource(source)
+	if err != nil {
+		return nil, err
+	}
+	goos, arch, ok := strings.Cut(platform, "_")
+	if !ok || goos == "" || arch == "" {
+		return nil, fmt.Errorf("invalid platform '%s' (expected os_arch, e.g. linux_amd64)", platform)
+	}
+
+	// Discover where the host serves the provider registry API
+	providersURL, err := registry.ServiceURL(host, registry.ProvidersV1)
+	if err != nil {
+		return nil, err
+	}
+
+	// Construct the URL for the package download metadata
+	url := fmt.Sprintf("%s%s/%s/download/%s/%s", providersURL, path, providerVersion, goos, arch)
+	log.Printf("Fetching package of provider %s %s for %s (URL: %s)", source, providerVersion, platform, url) // Debug log
+
+	body, err := httpcache.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch package of provider '%s' %s for %s: %v", source, providerVersion, platform, err)
+	}
+
+	var pkg Package
+	if err := json.Unmarshal(body, &pkg); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal package of provider '%s': %v", source, err)
+	}
+	if pkg.DownloadURL == "" || pkg.SHASumsURL == "" {
+		return nil, fmt.Errorf("incomplete package metadata for provider '%s' %s for %s", source, providerVersion, platform)
+	}
+
+	// URLs may be relative to the metadata URL
+	base, err := neturl.Parse(url)
+	if err != nil {
+		return nil, err
+	}
+	for _, ref := range []*string{&pkg.DownloadURL, &pkg.SHASumsURL, &pkg.SHASumsSignatureURL} {
+		if resolved, err := base.Parse(*ref); err == nil && *ref != "" {
+			*ref = resolved.String()
+		}
+	}
+
+	return &pkg, nil
+}
@@ -3,10 +3,13 @@ package provider
 import (
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"log"
-	"net/http"
 	"sort"
+	"strings"
+
+	"tfau/lib/constraint"
+	"tfau/lib/httpcache"
+	"tfau/lib/registry"
 
 	"github.com/hashicorp/go-version"
 	"github.com/hashicorp/hcl/v2"
@@ -15,53 +18,254 @@ import (
 	"github.com/zclconf/go-cty/cty"
 )
 
-// UpdateProviderVersions updates the provider versions in the HCL content and writes it back to the file.
-func UpdateProviderVersions(filename string, latestVersions map[string]string) error {
-	// Read the file content
-	src, err := ioutil.ReadFile(filename)
-	if err != nil {
-		return fmt.Errorf("failed to read file: %v", err)
-	}
+// Block types a provider version constraint can be declared in.
+const (
+	BlockProvider          = "provider"           // Legacy version attribute of a provider block
+	BlockRequiredProviders = "required_providers" // Entry of a terraform required_providers block
+)
 
-	// Parse the HCL content
-	file, diags := hclwrite.ParseConfig(src, filename, hcl.Pos{Line: 1, Column: 1})
-	if diags.HasErrors() {
-		return fmt.Errorf("failed to parse HCL content: %s", diags)
+// Requirement is a provider version constraint declared in a file.
+type Requirement struct {
+	Name      string // Local name: provider block label or required_providers key
+	Source    string // Source address, hashicorp/<name> when the file does not give one
+	Version   string // Version constraint
+	BlockType string // BlockProvider or BlockRequiredProviders
+}
+
+// DefaultSource returns the source address Terraform assumes for a provider local
+// name without an explicit source.
+func DefaultSource(name string) string {
+	return "hashicorp/" + name
+}
+
+// UpdateProviderVersions updates the provider versions in the in-memory HCL document.
+// The latest versions are keyed by source address. The module sources (see Sources)
+// map the local names declared in the other files of the module; nil considers the
+// document alone.
+func UpdateProviderVersions(file *hclwrite.File, latestVersions map[string]string, moduleSources map[string]string) {
+	body := file.Body()
+	sources := localSources(body)
+	for name, source := range moduleSources {
+		if _, declared := sources[name]; !declared {
+			sources[name] = source
+		}
 	}
 
 	// Iterate over the blocks to find provider blocks and required_providers
-	body := file.Body()
 	for _, block := range body.Blocks() {
-		if block.Type() == "provider" {
+		if block.Type() == "provider" && len(block.Labels()) > 0 {
 			// Update the version attribute in the provider block
 			providerName := block.Labels()[0]
-			if latestVersion, exists := latestVersions[providerName]; exists {
-				block.Body().SetAttributeValue("version", cty.StringVal(latestVersion))
+			source, ok := sources[providerName]
+			if !ok {
+				source = DefaultSource(providerName)
+			}
+			attr := block.Body().GetAttribute("version")
+			if latestVersion, exists := latestVersions[source]; exists && attr != nil {
+				value, err := attributeValue(attr)
+				if err != nil || value.Type() != cty.String {
+					log.Printf("Warning: Skipping version of provider '%s': version is not a string", providerName)
+					continue
+				}
+				newVersion, err := constraint.Rewrite(value.AsString(), latestVersion)
+				if err != nil {
+					log.Printf("Warning: Skipping version of provider '%s': %v", providerName, err)
+					continue
+				}
+				block.Body().SetAttributeValue("version", cty.StringVal(newVersion))
 			}
 		} else if block.Type() == "terraform" {
 			// Handle the `required_providers` block
 			for _, innerBlock := range block.Body().Blocks() {
-				if innerBlock.Type() == "required_providers" {
-					// Update the version attribute in the required_providers block
-					for providerName, attr := range innerBlock.Body().Attributes() {
-						fullProviderName := "hashicorp/" + providerName
-						if latestVersion, exists := latestVersions[fullProviderName]; exists {
-							// Update the version in the attribute value
-							attr.Expr().Variables()
-							innerBlock.Body().SetAttributeValue(providerName, cty.StringVal(latestVersion))
-						}
+				if innerBlock.Type() != "required_providers" {
+					continue
+				}
+				for providerName, attr := range innerBlock.Body().Attributes() {
+					entry, err := parseEntry(attr)
+					if err != nil {
+						log.Printf("Warning: Skipping version of provider '%s': %v", providerName, err)
+						continue
+					}
+					source, version, short := entrySource(providerName, entry)
+					latestVersion, exists := latestVersions[source]
+					if !exists || version == "" {
+						continue
+					}
+
+					newVersion, err := constraint.Rewrite(version, latestVersion)
+					if err != nil {
+						log.Printf("Warning: Skipping version of provider '%s': %v", providerName, err)
+						continue
+					}
+
+					if short {
+						// String format: rewrite the constraint in place
+						innerBlock.Body().SetAttributeValue(providerName, cty.StringVal(newVersion))
+						continue
+					}
+
+					// Object format: only edit the version key, keeping the other keys and the layout
+					tokens, err := replaceObjectVersion(attr.Expr().BuildTokens(nil), newVersion)
+					if err != nil {
+						log.Printf("Warning: Skipping version of provider '%s': %v", providerName, err)
+						continue
 					}
+					innerBlock.Body().SetAttributeRaw(providerName, tokens)
+				}
+			}
+		}
+	}
+}
+
+// ExpandRequiredProviders converts the short-form required_providers entries of the
+// document (google = "~> 6.0") to the object form with an explicit source.
+func ExpandRequiredProviders(file *hclwrite.File) {
+	for _, block := range file.Body().Blocks() {
+		if block.Type() != "terraform" {
+			continue
+		}
+		for _, innerBlock := range block.Body().Blocks() {
+			if innerBlock.Type() != "required_providers" {
+				continue
+			}
+			for _, providerName := range sortedNames(innerBlock.Body().Attributes()) {
+				attr := innerBlock.Body().GetAttribute(providerName)
+				value, err := attributeValue(attr)
+				if err != nil || value.Type() != cty.String {
+					continue
+				}
+				innerBlock.Body().SetAttributeRaw(providerName, hclwrite.TokensForObject([]hclwrite.ObjectAttrTokens{
+					{Name: hclwrite.TokensForIdentifier("source"), Value: hclwrite.TokensForValue(cty.StringVal(DefaultSource(providerName)))},
+					{Name: hclwrite.TokensForIdentifier("version"), Value: hclwrite.TokensForValue(value)},
+				}))
+			}
+		}
+	}
+}
+
+// localSources maps the local names declared in the required_providers blocks of an
+// hclwrite body to their source addresses.
+func localSources(body *hclwrite.Body) map[string]string {
+	sources := make(map[string]string)
+	for _, block := range body.Blocks() {
+		if block.Type() != "terraform" {
+			continue
+		}
+		for _, innerBlock := range block.Body().Blocks() {
+			if innerBlock.Type() != "required_providers" {
+				continue
+			}
+			for providerName, attr := range innerBlock.Body().Attributes() {
+				if entry, err := parseEntry(attr); err == nil {
+					sources[providerName], _, _ = entrySource(providerName, entry)
 				}
 			}
 		}
 	}
+	return sources
+}
+
+// parseEntry parses the expression of an hclwrite attribute.
+func parseEntry(attr *hclwrite.Attribute) (hcl.Expression, error) {
+	expr, diags := hclsyntax.ParseExpression(attr.Expr().BuildTokens(nil).Bytes(), "", hcl.Pos{Line: 1, Column: 1})
+	if diags.HasErrors() {
+		return nil, fmt.Errorf("failed to parse expression: %s", diags)
+	}
+	return expr, nil
+}
+
+// entrySource returns the source address and version constraint of a required_providers
+// entry, and whether it uses the short (version string only) form. Only the source and
+// version keys of the object form are evaluated, so configuration_aliases and other
+// references do not get in the way.
+func entrySource(name string, expr hcl.Expression) (string, string, bool) {
+	// String format: ">=4.84", the provider is from the "hashicorp" namespace
+	if value, diags := expr.Value(nil); !diags.HasErrors() && value.Type() == cty.String && !value.IsNull() {
+		return DefaultSource(name), value.AsString(), true
+	}
+
+	// Object format: { source = "hashicorp/google", version = "6.22.0" }
+	source, version := DefaultSource(name), ""
+	items, diags := hcl.ExprMap(expr)
+	if diags.HasErrors() {
+		return source, version, false
+	}
+	for _, item := range items {
+		key, diags := item.Key.Value(nil)
+		if diags.HasErrors() || key.Type() != cty.String || key.IsNull() {
+			continue
+		}
+		value, diags := item.Value.Value(nil)
+		if diags.HasErrors() || value.Type() != cty.String || value.IsNull() {
+			continue
+		}
+		switch key.AsString() {
+		case "source":
+			source = value.AsString()
+		case "version":
+			version = value.AsString()
+		}
+	}
+	return source, version, false
+}
+
+// replaceObjectVersion returns a copy of the tokens of an object expression with the
+// string value of its top-level version key replaced.
+func replaceObjectVersion(tokens hclwrite.Tokens, newVersion string) (hclwrite.Tokens, error) {
+	updated := make(hclwrite.Tokens, len(tokens))
+	for i, token := range tokens {
+		copied := *token
+		updated[i] = &copied
+	}
+
+	depth := 0
+	for i, token := range updated {
+		switch token.Type {
+		case hclsyntax.TokenOBrace, hclsyntax.TokenOBrack, hclsyntax.TokenOParen, hclsyntax.TokenTemplateInterp:
+			depth++
+		case hclsyntax.TokenCBrace, hclsyntax.TokenCBrack, hclsyntax.TokenCParen, hclsyntax.TokenTemplateSeqEnd:
+			depth--
+		case hclsyntax.TokenIdent:
+			// Match version = "..." directly inside the object braces
+			if depth != 1 || string(token.Bytes) != "version" || i+4 >= len(updated) {
+				continue
+			}
+			equal, open, literal, closing := updated[i+1], updated[i+2], updated[i+3], updated[i+4]
+			if (equal.Type != hclsyntax.TokenEqual && equal.Type != hclsyntax.TokenColon) ||
+				open.Type != hclsyntax.TokenOQuote || literal.Type != hclsyntax.TokenQuotedLit || closing.Type != hclsyntax.TokenCQuote {
+				return nil, fmt.Errorf("version is not a literal string")
+			}
+			literal.Bytes = hclwrite.TokensForValue(cty.StringVal(newVersion))[1].Bytes
+			return updated, nil
+		}
+	}
+	return nil, fmt.Errorf("no version key found")
+}
 
-	// Write the updated content back to the file
-	if err := ioutil.WriteFile(filename, file.Bytes(), 0644); err != nil {
-		return fmt.Errorf("failed to write file: %v", err)
+// sortedNames returns the attribute names of an hclwrite body in lexical order.
+func sortedNames(attrs map[string]*hclwrite.Attribute) []string {
+	names := make([]string, 0, len(attrs))
+	for name := range attrs {
+		names = append(names, name)
 	}
+	sort.Strings(names)
+	return names
+}
 
-	return nil
+// attributeValue evaluates a literal attribute of an hclwrite body.
+func attributeValue(attr *hclwrite.Attribute) (cty.Value, error) {
+	expr, err := parseEntry(attr)
+	if err != nil {
+		return cty.NilVal, err
+	}
+	value, diags := expr.Value(nil)
+	if diags.HasErrors() {
+		return cty.NilVal, fmt.Errorf("failed to evaluate expression: %s", diags)
+	}
+	if value.IsNull() || (value.Type() != cty.String && !value.Type().IsObjectType()) {
+		return cty.NilVal, fmt.Errorf("expression is neither a string nor an object")
+	}
+	return value, nil
 }
 
 // ProviderLatestVersion represents the latest version of a provider from the Terraform Registry.
@@ -76,127 +280,161 @@ type ProviderVersions struct {
 	} `json:"versions"`
 }
 
-// Extract extracts provider names and their versions from the parsed content.
-func Extract(content *hcl.BodyContent) (map[string]string, error) {
-	// Create a map to store provider names and versions
-	providers := make(map[string]string)
+// Extract extracts the provider version constraints from the parsed content, from
+// required_providers entries and from the version attribute of provider blocks. Each
+// is identified by its source address, taken from required_providers when given. The
+// module sources (see Sources) map the local names declared in the other files of the
+// module; nil considers the content alone.
+func Extract(content *hcl.BodyContent, moduleSources map[string]string) ([]Requirement, error) {
+	var requirements []Requirement
+	sources := make(map[string]string) // Local name -> source address
+	for name, source := range moduleSources {
+		sources[name] = source
+	}
 
-	// Iterate over the blocks to find all provider blocks
+	// Iterate over the terraform blocks first, they map local names to sources
 	for _, block := range content.Blocks {
-		if block.Type == "provider" {
-			// Get the provider name
-			providerName := block.Labels[0]
+		if block.Type != "terraform" {
+			continue
+		}
 
-			// Decode the attributes of the provider block
-			attrs, diags := block.Body.JustAttributes()
-			if diags.HasErrors() {
-				return nil, fmt.Errorf("failed to decode attributes for provider '%s': %s", providerName, diags)
-			}
+		// Handle the `terraform` block to extract `required_providers`
+		body, ok := block.Body.(*hclsyntax.Body)
+		if !ok {
+			return nil, fmt.Errorf("failed to parse terraform block body")
+		}
 
-			// Get the value of the "version" attribute
-			versionAttr, exists := attrs["version"]
-			if !exists {
-				// If the provider doesn't have a "version" attribute, skip it
+		// Look for the `required_providers` block
+		for _, innerBlock := range body.Blocks {
+			if innerBlock.Type != "required_providers" {
 				continue
 			}
 
-			versionValue, diags := versionAttr.Expr.Value(nil)
+			// Decode the attributes of the `required_providers` block
+			attrs, diags := innerBlock.Body.JustAttributes()
 			if diags.HasErrors() {
-				return nil, fmt.Errorf("failed to evaluate 'version' expression for provider '%s': %s", providerName, diags)
-			}
-
-			// Store the provider name and version in the map
-			providers[providerName] = versionValue.AsString()
-		} else if block.Type == "terraform" {
-			// Handle the `terraform` block to extract `required_providers`
-			body, ok := block.Body.(*hclsyntax.Body)
-			if !ok {
-				return nil, fmt.Errorf("failed to parse terraform block body")
+				return nil, fmt.Errorf("failed to decode attributes for required_providers block: %s", diags)
 			}
 
-			// Look for the `required_providers` block
-			for _, innerBlock := range body.Blocks {
-				if innerBlock.Type == "required_providers" {
-					// Decode the attributes of the `required_providers` block
-					attrs, diags := innerBlock.Body.JustAttributes()
-					if diags.HasErrors() {
-						return nil, fmt.Errorf("failed to decode attributes for required_providers block: %s", diags)
+			// Extract provider sources and versions from the attributes
+			for providerName, attr := range attrs {
+				if _, diags := hcl.ExprMap(attr.Expr); diags.HasErrors() {
+					if value, diags := attr.Expr.Value(nil); diags.HasErrors() || value.Type() != cty.String || value.IsNull() {
+						return nil, fmt.Errorf("provider '%s' has an unsupported format", providerName)
 					}
+				}
 
-					// Extract provider versions from the attributes
-					for providerName, attr := range attrs {
-						// Evaluate the attribute value
-						value, diags := attr.Expr.Value(nil)
-						if diags.HasErrors() {
-							return nil, fmt.Errorf("failed to evaluate expression for provider '%s': %s", providerName, diags)
-						}
-
-						// Handle both object and string formats
-						if value.Type().IsObjectType() {
-							// Object format: { source = "hashicorp/google", version = "6.22.0" }
-							providerMap := value.AsValueMap()
-							sourceValue, ok := providerMap["source"]
-							if !ok {
-								return nil, fmt.Errorf("provider '%s' is missing 'source' attribute", providerName)
-							}
-							source := sourceValue.AsString()
-
-							versionValue, ok := providerMap["version"]
-							if !ok {
-								return nil, fmt.Errorf("provider '%s' is missing 'version' attribute", providerName)
-							}
-							version := versionValue.AsString()
-
-							// Store the provider source and version in the map
-							providers[source] = version
-						} else if value.Type().IsPrimitiveType() {
-							// String format: ">=4.84"
-							version := value.AsString()
-							// Assume the provider is from the "hashicorp" namespace
-							providers["hashicorp/"+providerName] = version
-						} else {
-							return nil, fmt.Errorf("provider '%s' has an unsupported format", providerName)
-						}
-					}
+				source, version, _ := entrySource(providerName, attr.Expr)
+				sources[providerName] = source
+				if version == "" {
+					// Nothing to upgrade without a version constraint
+					continue
 				}
+				requirements = append(requirements, Requirement{
+					Name:      providerName,
+					Source:    source,
+					Version:   version,
+					BlockType: BlockRequiredProviders,
+				})
 			}
 		}
 	}
 
-	return providers, nil
+	// Then iterate over the provider blocks
+	for _, block := range content.Blocks {
+		if block.Type != "provider" {
+			continue
+		}
+
+		// Get the provider name
+		providerName := block.Labels[0]
+
+		// Decode the attributes of the provider block
+		attrs, diags := block.Body.JustAttributes()
+		if diags.HasErrors() {
+			return nil, fmt.Errorf("failed to decode attributes for provider '%s': %s", providerName, diags)
+		}
+
+		// Get the value of the "version" attribute
+		versionAttr, exists := attrs["version"]
+		if !exists {
+			// If the provider doesn't have a "version" attribute, skip it
+			continue
+		}
+
+		versionValue, diags := versionAttr.Expr.Value(nil)
+		if diags.HasErrors() || versionValue.Type() != cty.String || versionValue.IsNull() {
+			return nil, fmt.Errorf("failed to evaluate 'version' expression for provider '%s': %s", providerName, diags)
+		}
+
+		source, ok := sources[providerName]
+		if !ok {
+			source = DefaultSource(providerName)
+		}
+		requirements = append(requirements, Requirement{
+			Name:      providerName,
+			Source:    source,
+			Version:   versionValue.AsString(),
+			BlockType: BlockProvider,
+		})
+	}
+
+	// Sort the requirements so that reports are stable
+	sort.SliceStable(requirements, func(i, j int) bool {
+		if requirements[i].BlockType != requirements[j].BlockType {
+			return requirements[i].BlockType > requirements[j].BlockType
+		}
+		return requirements[i].Name < requirements[j].Name
+	})
+
+	return requirements, nil
 }
 
-// GetLatestVersion fetches the latest version of a provider from the Terraform Registry.
-func GetLatestVersion(providerName string) (string, error) {
-	// Construct the URL for the Terraform Registry API
-	url := fmt.Sprintf("https://registry.terraform.io/v1/providers/%s/versions", providerName)
-	log.Printf("Fetching versions for provider: %s (URL: %s)", providerName, url) // Debug log
+// splitSource splits a provider source address ([<HOSTNAME>/]<NAMESPACE>/<TYPE>)
+// into its registry host and the namespace/type path.
+func splitSource(source string) (string, string, error) {
+	parts := strings.Split(source, "/")
+	switch len(parts) {
+	case 2:
+		return registry.DefaultHost, source, nil
+	case 3:
+		return strings.ToLower(parts[0]), parts[1] + "/" + parts[2], nil
+	}
+	return "", "", fmt.Errorf("invalid provider source address: %s", source)
+}
 
-	resp, err := http.Get(url)
+// ListVersions fetches all versions of a provider from its registry.
+func ListVersions(providerName string) ([]*version.Version, error) {
+	host, path, err := splitSource(providerName)
 	if err != nil {
-		return "", fmt.Errorf("failed to fetch versions for provider '%s': %v", providerName, err)
+		return nil, err
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("failed to fetch versions for provider '%s': %s", providerName, resp.Status)
+	// Discover where the host serves the provider registry API
+	providersURL, err := registry.ServiceURL(host, registry.ProvidersV1)
+	if err != nil {
+		return nil, err
 	}
 
-	body, err := ioutil.ReadAll(resp.Body)
+	// Construct the URL for the provider registry API
+	url := fmt.Sprintf("%s%s/versions", providersURL, path)
+	log.Printf("Fetching versions for provider: %s (URL: %s)", providerName, url) // Debug log
+
+	body, err := httpcache.Get(url)
 	if err != nil {
-		return "", fmt.Errorf("failed to read response body for provider '%s': %v", providerName, err)
+		return nil, fmt.Errorf("failed to fetch versions for provider '%s': %v", providerName, err)
 	}
 
 	var versions ProviderVersions
 	if err := json.Unmarshal(body, &versions); err != nil {
-		return "", fmt.Errorf("failed to unmarshal response for provider '%s': %v", providerName, err)
+		return nil, fmt.Errorf("failed to unmarshal response for provider '%s': %v", providerName, err)
 	}
 
 	if len(versions.Versions) == 0 {
-		return "", fmt.Errorf("no versions found for provider '%s'", providerName)
+		return nil, fmt.Errorf("no versions found for provider '%s'", providerName)
 	}
 
-	// Parse versions and sort them
+	// Parse versions
 	var versionList []*version.Version
 	for _, v := range versions.Versions {
 		parsedVersion, err := version.NewVersion(v.Version)
@@ -208,40 +446,8 @@ func GetLatestVersion(providerName string) (string, error) {
 	}
 
 	if len(versionList) == 0 {
-		return "", fmt.Errorf("no valid versions found for provider '%s'", providerName)
-	}
-
-	// Sort versions in descending order
-	sort.Sort(sort.Reverse(version.Collection(versionList)))
-
-	// The latest version is the first item in the sorted list
-	latestVersion := versionList[0].String()
-	return latestVersion, nil
-}
-
-// ExtractWithLatestVersions extracts provider names, their current versions, and their latest versions.
-func ExtractWithLatestVersions(content *hcl.BodyContent) (map[string]string, map[string]string, error) {
-	// Extract current versions
-	providers, err := Extract(content)
-	if err != nil {
-		return nil, nil, err
+		return nil, fmt.Errorf("no valid versions found for provider '%s'", providerName)
 	}
 
-	log.Printf("Extracted providers: %v", providers) // Debug log
-
-	// Create a map to store the latest versions
-	latestVersions := make(map[string]string)
-
-	// Fetch the latest version for each provider
-	for name := range providers {
-		latestVersion, err := GetLatestVersion(name)
-		if err != nil {
-			return nil, nil, fmt.Errorf("failed to get latest version for provider '%s': %v", name, err)
-		}
-		latestVersions[name] = latestVersion
-	}
-
-	log.Printf("Latest versions: %v", latestVersions) // Debug log
-
-	return providers, latestVersions, nil
+	return versionList, nil
 }
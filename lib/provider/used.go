@@ -0,0 +1,94 @@
+package provider
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+)
+
+// builtinName is the local name of the provider built into Terraform, which is never
+// installed nor locked.
+const builtinName = "terraform"
+
+// Sources maps the local names declared in the required_providers blocks of the
+// contents of a module to their source addresses. Pass every file of the module at
+// once, as its terraform block is often split across versions.tf, providers.tf and
+// main.tf.
+func Sources(contents ...*hcl.BodyContent) map[string]string {
+	sources := make(map[string]string) // Local name -> source address
+	for _, content := range contents {
+		for _, block := range content.Blocks {
+			body, ok := block.Body.(*hclsyntax.Body)
+			if !ok || block.Type != "terraform" {
+				continue
+			}
+			for _, innerBlock := range body.Blocks {
+				if innerBlock.Type != "required_providers" {
+					continue
+				}
+				for providerName, attr := range innerBlock.Body.Attributes {
+					sources[providerName], _, _ = entrySource(providerName, attr.Expr)
+				}
+			}
+		}
+	}
+	return sources
+}
+
+// Used returns the source addresses of every provider the contents of a module use,
+// like Terraform infers them: the entries of required_providers blocks (with or without
+// a version), the local names configured by provider blocks, and the providers implied
+// by the type of resources, data sources and ephemeral resources (aws_instance uses
+// aws) or named by their provider argument. Local names are mapped to sources with the
+// required_providers blocks of every content, so pass all the files of a module at once.
+func Used(contents ...*hcl.BodyContent) []string {
+	// Every required_providers entry is used, with or without a version
+	sources := Sources(contents...)
+	var names []string // Local names used outside required_providers
+
+	for _, content := range contents {
+		for _, block := range content.Blocks {
+			body, ok := block.Body.(*hclsyntax.Body)
+			if !ok {
+				continue
+			}
+
+			switch block.Type {
+			case "provider":
+				names = append(names, block.Labels[0])
+			case "resource", "data", "ephemeral":
+				// The provider argument (provider = google-beta.west) overrides the type prefix
+				if attr, exists := body.Attributes["provider"]; exists {
+					if traversal, diags := hcl.AbsTraversalForExpr(attr.Expr); !diags.HasErrors() {
+						names = append(names, traversal.RootName())
+						continue
+					}
+				}
+				providerName, _, _ := strings.Cut(block.Labels[0], "_")
+				names = append(names, providerName)
+			}
+		}
+	}
+
+	// Resolve the local names, defaulting to the hashicorp namespace
+	used := make(map[string]bool)
+	for _, source := range sources {
+		used[source] = true
+	}
+	for _, providerName := range names {
+		if source, ok := sources[providerName]; ok {
+			used[source] = true
+		} else if providerName != builtinName {
+			used[DefaultSource(providerName)] = true
+		}
+	}
+
+	addresses := make([]string, 0, len(used))
+	for source := range used {
+		addresses = append(addresses, source)
+	}
+	sort.Strings(addresses)
+	return addresses
+}
@@ -0,0 +1,290 @@
+package registry
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// credentialsHelper is a credentials_helper block of the CLI configuration.
+type credentialsHelper struct {
+	name string
+	args []string
+}
+
+// cliCredentials holds the credentials configured for Terraform itself.
+type cliCredentials struct {
+	tokens map[string]string // Host -> token from credentials blocks and credentials.tfrc.json
+	helper *credentialsHelper
+}
+
+var (
+	credentialsOnce sync.Once
+	credentials     *cliCredentials
+
+	helperMu     sync.Mutex
+	helperTokens = make(map[string]string) // Host -> token returned by the credentials helper
+)
+
+// Token returns the API token for a registry host, from the same sources Terraform
+// uses, in the same order: a TF_TOKEN_<host> environment variable, a credentials block
+// in the CLI configuration or credentials.tfrc.json, then the credentials helper.
+// It returns an empty string when no credentials are configured for the host.
+func Token(host string) string {
+	host = strings.ToLower(host)
+
+	// Environment variables take precedence
+	if token := tokenFromEnv(host); token != "" {
+		return token
+	}
+
+	// Then credentials configured in the CLI configuration files
+	credentialsOnce.Do(func() {
+		credentials = loadCLICredentials()
+	})
+	if token, ok := credentials.tokens[host]; ok {
+		return token
+	}
+
+	// Finally the credentials helper, if any
+	if credentials.helper != nil {
+		return tokenFromHelper(credentials.helper, host)
+	}
+	return ""
+}
+
+// tokenFromEnv looks up TF_TOKEN_<host>, where periods are encoded as underscores
+// and hyphens as double underscores (e.g. TF_TOKEN_app_terraform_io).
+func tokenFromEnv(host string) string {
+	name := strings.ReplaceAll(host, "-", "__")
+	name = strings.ReplaceAll(name, ".", "_")
+	name = strings.ReplaceAll(name, ":", "_")
+
+	if token := os.Getenv("TF_TOKEN_" + name); token != "" {
+		return token
+	}
+
+	// Environment variable names are case-sensitive on most systems
+	for _, env := range os.Environ() {
+		key, value, _ := strings.Cut(env, "=")
+		if strings.EqualFold(key, "TF_TOKEN_"+name) && value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// loadCLICredentials reads the credentials from the CLI configuration file
+// (TF_CLI_CONFIG_FILE or ~/.terraformrc) and credentials.tfrc.json.
+func loadCLICredentials() *cliCredentials {
+	creds := &cliCredentials{tokens: make(map[string]string)}
+
+	// credentials.tfrc.json is written by `terraform login`
+	if dir := configDir(); dir != "" {
+		loadCredentialsJSON(filepath.Join(dir, "credentials.tfrc.json"), creds)
+	}
+
+	if path := cliConfigFile(); path != "" {
+		loadCLIConfig(path, creds)
+	}
+
+	return creds
+}
+
+// configDir returns Terraform's per-user configuration directory.
+func configDir() string {
+	if runtime.GOOS == "windows" {
+		if appData := os.Getenv("APPDATA"); appData != "" {
+			return filepath.Join(appData, "terraform.d")
+		}
+		return ""
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".terraform.d")
+}
+
+// cliConfigFile returns the path of the CLI configuration file.
+func cliConfigFile() string {
+	if path := os.Getenv("TF_CLI_CONFIG_FILE"); path != "" {
+		return path
+	}
+	if path := os.Getenv("TERRAFORM_CONFIG"); path != "" {
+		return path
+	}
+	if runtime.GOOS == "windows" {
+		if appData := os.Getenv("APPDATA"); appData != "" {
+			return filepath.Join(appData, "terraform.rc")
+		}
+		return ""
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".terraformrc")
+}
+
+// loadCredentialsJSON reads a credentials.tfrc.json file.
+func loadCredentialsJSON(path string, creds *cliCredentials) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+
+	var file struct {
+		Credentials map[string]struct {
+			Token string `json:"token"`
+		} `json:"credentials"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		log.Printf("Warning: Ignoring invalid credentials file %s: %v", path, err)
+		return
+	}
+
+	for host, entry := range file.Credentials {
+		creds.tokens[strings.ToLower(host)] = entry.Token
+	}
+}
+
+// loadCLIConfig reads the credentials and credentials_helper blocks of a CLI
+// configuration file. Credentials blocks override credentials.tfrc.json.
+func loadCLIConfig(path string, creds *cliCredentials) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+
+	file, diags := hclsyntax.ParseConfig(src, path, hcl.Pos{Line: 1, Column: 1})
+	if diags.HasErrors() {
+		log.Printf("Warning: Ignoring invalid CLI configuration file %s: %s", path, diags)
+		return
+	}
+	body, ok := file.Body.(*hclsyntax.Body)
+	if !ok {
+		return
+	}
+
+	for _, block := range body.Blocks {
+		switch {
+		case block.Type == "credentials" && len(block.Labels) == 1:
+			attr, ok := block.Body.Attributes["token"]
+			if !ok {
+				continue
+			}
+			value, diags := attr.Expr.Value(nil)
+			if diags.HasErrors() || value.Type() != cty.String || value.IsNull() {
+				log.Printf("Warning: Ignoring credentials for %s in %s: token is not a string", block.Labels[0], path)
+				continue
+			}
+			creds.tokens[strings.ToLower(block.Labels[0])] = value.AsString()
+		case block.Type == "credentials_helper" && len(block.Labels) == 1:
+			helper := &credentialsHelper{name: block.Labels[0]}
+			if attr, ok := block.Body.Attributes["args"]; ok {
+				value, diags := attr.Expr.Value(nil)
+				if diags.HasErrors() || !value.Type().IsTupleType() && !value.Type().IsListType() {
+					log.Printf("Warning: Ignoring args of credentials helper %s in %s", helper.name, path)
+				} else {
+					for _, arg := range value.AsValueSlice() {
+						if arg.Type() == cty.String && !arg.IsNull() {
+							helper.args = append(helper.args, arg.AsString())
+						}
+					}
+				}
+			}
+			creds.helper = helper
+		}
+	}
+}
+
+// tokenFromHelper asks the credentials helper for a host's token using Terraform's
+// exec protocol: `terraform-credentials-<name> [args...] get <host>` prints a JSON
+// object with a "token" property, or an empty object when it has no credentials.
+func tokenFromHelper(helper *credentialsHelper, host string) string {
+	helperMu.Lock()
+	defer helperMu.Unlock()
+
+	if token, ok := helperTokens[host]; ok {
+		return token
+	}
+
+	token, err := runHelper(helper, host)
+	if err != nil {
+		log.Printf("Warning: Credentials helper %s failed for %s: %v", helper.name, host, err)
+	}
+	helperTokens[host] = token
+	return token
+}
+
+// runHelper runs the credentials helper executable for a host.
+func runHelper(helper *credentialsHelper, host string) (string, error) {
+	path, err := findHelper(helper.name)
+	if err != nil {
+		return "", err
+	}
+
+	args := append(append([]string{}, helper.args...), "get", host)
+	cmd := exec.Command(path, args...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("%v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	var response struct {
+		Token string `json:"token"`
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &response); err != nil {
+		return "", fmt.Errorf("invalid response: %v", err)
+	}
+	return response.Token, nil
+}
+
+// findHelper locates terraform-credentials-<name> in the plugin directories.
+func findHelper(name string) (string, error) {
+	executable := "terraform-credentials-" + name
+	if runtime.GOOS == "windows" {
+		executable += ".exe"
+	}
+
+	var dirs []string
+	if dir := configDir(); dir != "" {
+		dirs = append(dirs, filepath.Join(dir, "plugins"))
+	}
+	if dataHome := os.Getenv("XDG_DATA_HOME"); dataHome != "" {
+		dirs = append(dirs, filepath.Join(dataHome, "terraform", "plugins"))
+	} else if home, err := os.UserHomeDir(); err == nil {
+		dirs = append(dirs, filepath.Join(home, ".local", "share", "terraform", "plugins"))
+	}
+
+	for _, dir := range dirs {
+		// Helpers live directly in the plugin directory or in its OS_ARCH subdirectory
+		for _, candidate := range []string{
+			filepath.Join(dir, executable),
+			filepath.Join(dir, runtime.GOOS+"_"+runtime.GOARCH, executable),
+		} {
+			if info, err := os.Stat(candidate); err == nil && !info.IsDir() {
+				return candidate, nil
+			}
+		}
+	}
+
+	// Fall back to the PATH
+	if path, err := exec.LookPath(executable); err == nil {
+		return path, nil
+	}
+	return "", fmt.Errorf("%s not found in the plugin directories", executable)
+}
@@ -0,0 +1,179 @@
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+
+	"tfau/lib/httpcache"
+)
+
+// Public registries of Terraform and OpenTofu.
+const (
+	TerraformHost = "registry.terraform.io"
+	OpenTofuHost  = "registry.opentofu.org"
+)
+
+// DefaultHost is the registry used by module and provider sources without a hostname.
+var DefaultHost = TerraformHost
+
+// Service identifiers advertised by registries through remote service discovery.
+const (
+	ModulesV1   = "modules.v1"
+	ProvidersV1 = "providers.v1"
+)
+
+// discovery is the outcome of the service discovery of a host, fetched once per run.
+type discovery struct {
+	once     sync.Once
+	services map[string]any
+	err      error
+}
+
+var (
+	discoveryMu sync.Mutex
+	discovered  = make(map[string]*discovery) // Host -> discovery outcome
+
+	apiHostsMu sync.Mutex
+	apiHosts   = make(map[string]string) // Host of a registry API -> host whose credentials it gets
+)
+
+// Discover fetches the remote service discovery document of a registry host
+// (https://<host>/.well-known/terraform.json), the way Terraform does. Documents
+// are fetched once per host and run; a failure is remembered too, so an unreachable
+// host is not retried for every dependency. Hosts are discovered concurrently.
+func Discover(host string) (map[string]any, error) {
+	discoveryMu.Lock()
+	d, ok := discovered[host]
+	if !ok {
+		d = &discovery{}
+		discovered[host] = d
+	}
+	discoveryMu.Unlock()
+
+	d.once.Do(func() {
+		// Like Terraform, the discovery request and the advertised APIs get the
+		// credentials of the registry host
+		registerAPIHost(host, host)
+		d.services, d.err = discover(host)
+		for _, apiHost := range serviceHosts(host, d.services) {
+			registerAPIHost(apiHost, host)
+		}
+	})
+	return d.services, d.err
+}
+
+// SetServices declares the services of a registry host, as configured by the CLI. The
+// host is never discovered; absolute service URLs let a mirror serve the registry.
+func SetServices(host string, services map[string]string) {
+	document := make(map[string]any, len(services))
+	for service, value := range services {
+		document[service] = value
+	}
+
+	d := &discovery{}
+	d.once.Do(func() {
+		d.services = document
+	})
+
+	discoveryMu.Lock()
+	discovered[host] = d
+	discoveryMu.Unlock()
+
+	// Declared services, often a mirror, get the credentials of their own host
+	registerAPIHost(host, host)
+	for _, apiHost := range serviceHosts(host, document) {
+		registerAPIHost(apiHost, apiHost)
+	}
+}
+
+// RequestToken returns the token sent with a request to a host: the token of the
+// registry whose API the host serves (see Token), or an empty string for any other
+// host, such as release APIs and package downloads.
+func RequestToken(host string) string {
+	apiHostsMu.Lock()
+	registryHost, ok := apiHosts[strings.ToLower(host)]
+	apiHostsMu.Unlock()
+	if !ok {
+		return ""
+	}
+	return Token(registryHost)
+}
+
+// registerAPIHost records that requests to a host are authenticated with the
+// credentials of a registry host.
+func registerAPIHost(host string, registryHost string) {
+	// Requests are matched by hostname, without port
+	if hostname, _, err := net.SplitHostPort(host); err == nil {
+		host = hostname
+	}
+
+	apiHostsMu.Lock()
+	defer apiHostsMu.Unlock()
+	if _, exists := apiHosts[strings.ToLower(host)]; !exists {
+		apiHosts[strings.ToLower(host)] = registryHost
+	}
+}
+
+// serviceHosts returns the hosts of the service URLs of a discovery document.
+func serviceHosts(host string, services map[string]any) []string {
+	base, _ := url.Parse("https://" + host + "/.well-known/terraform.json")
+	var hosts []string
+	for _, value := range services {
+		service, ok := value.(string)
+		if !ok {
+			continue
+		}
+		if ref, err := url.Parse(service); err == nil {
+			hosts = append(hosts, base.ResolveReference(ref).Hostname())
+		}
+	}
+	return hosts
+}
+
+// discover fetches and decodes the service discovery document of a host.
+func discover(host string) (map[string]any, error) {
+	discoveryURL := "https://" + host + "/.well-known/terraform.json"
+	log.Printf("Discovering services of %s (URL: %s)", host, discoveryURL)
+
+	body, err := httpcache.Get(discoveryURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover services of %s: %v", host, err)
+	}
+
+	var services map[string]any
+	if err := json.Unmarshal(body, &services); err != nil {
+		return nil, fmt.Errorf("failed to decode service discovery document of %s: %v", host, err)
+	}
+	return services, nil
+}
+
+// ServiceURL returns the base URL of a service advertised by a registry host, with a
+// trailing slash. Relative paths are resolved against the discovery document URL.
+func ServiceURL(host string, service string) (string, error) {
+	services, err := Discover(host)
+	if err != nil {
+		return "", err
+	}
+
+	value, ok := services[service].(string)
+	if !ok {
+		return "", fmt.Errorf("host %s does not provide the %s service", host, service)
+	}
+
+	base, _ := url.Parse("https://" + host + "/.well-known/terraform.json")
+	ref, err := url.Parse(value)
+	if err != nil {
+		return "", fmt.Errorf("invalid %s service URL '%s' advertised by %s: %v", service, value, host, err)
+	}
+
+	serviceURL := base.ResolveReference(ref).String()
+	if !strings.HasSuffix(serviceURL, "/") {
+		serviceURL += "/"
+	}
+	return serviceURL, nil
+}
@@ -0,0 +1,58 @@
+package registry
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestRequestToken(t *testing.T) {
+	// Only environment variables hold credentials
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("TF_CLI_CONFIG_FILE", filepath.Join(home, "missing.tfrc"))
+	t.Setenv("TF_TOKEN_registry_example_com", "registry-token")
+	t.Setenv("TF_TOKEN_mirror_example_com", "mirror-token")
+	t.Setenv("TF_TOKEN_releases_hashicorp_com", "leaked-token")
+
+	SetServices("registry.example.com", map[string]string{ProvidersV1: "/v1/providers/"})
+	SetServices("registry.terraform.io", map[string]string{ModulesV1: "https://mirror.example.com:8443/modules/"})
+
+	tests := []struct {
+		host string
+		want string
+	}{
+		{"registry.example.com", "registry-token"},
+		{"Registry.Example.com", "registry-token"},
+		{"mirror.example.com", "mirror-token"},
+		{"releases.hashicorp.com", ""},
+		{"objects.githubusercontent.com", ""},
+	}
+	for _, test := range tests {
+		if got := RequestToken(test.host); got != test.want {
+			t.Errorf("RequestToken(%q) = %q, want %q", test.host, got, test.want)
+		}
+	}
+}
+
+func TestServiceURL(t *testing.T) {
+	SetServices("private.example.com", map[string]string{
+		ModulesV1:   "/api/modules/v1",
+		ProvidersV1: "https://cdn.example.com/providers/v1/",
+	})
+	tests := []struct {
+		service string
+		want    string
+	}{
+		{ModulesV1, "https://private.example.com/api/modules/v1/"},
+		{ProvidersV1, "https://cdn.example.com/providers/v1/"},
+	}
+	for _, test := range tests {
+		got, err := ServiceURL("private.example.com", test.service)
+		if err != nil || got != test.want {
+			t.Errorf("ServiceURL(%q) = %q, %v, want %q", test.service, got, err, test.want)
+		}
+	}
+	if _, err := ServiceURL("private.example.com", "login.v1"); err == nil {
+		t.Errorf("ServiceURL returned no error for a service the host does not provide")
+	}
+}
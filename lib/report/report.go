@@ -0,0 +1,130 @@
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+)
+
+// Action is what tfau did, or would do, with a dependency.
+type Action string
+
+const (
+	ActionUpToDate     Action = "up-to-date"   // The constraint already targets the latest version
+	ActionOutdated     Action = "outdated"     // A newer version exists but the file was not written
+	ActionUpdated      Action = "updated"      // The file was rewritten with the proposed constraint
+	ActionError        Action = "error"        // The dependency could not be parsed, resolved or rewritten
+	ActionInconsistent Action = "inconsistent" // The lock file disagrees with the configuration
+	ActionIgnored      Action = "ignored"      // A rule of the configuration file excludes the dependency
+	ActionSkipped      Action = "skipped"      // The current version cannot be compared, the dependency is left as is
+)
+
+// Block types reported for each dependency.
+const (
+	BlockModule            = "module"
+	BlockProvider          = "provider"
+	BlockRequiredProviders = "required_providers"
+	BlockTerraform         = "terraform"
+)
+
+// Result describes a single dependency found in a file.
+type Result struct {
+	File      string `json:"file"`
+	BlockType string `json:"block_type,omitempty"`
+	BlockName string `json:"block_name,omitempty"`
+	Source    string `json:"source,omitempty"`
+	Current   string `json:"current,omitempty"`
+	Latest    string `json:"latest,omitempty"`
+	Proposed  string `json:"proposed,omitempty"`
+	Action    Action `json:"action"`
+	Error     string `json:"error,omitempty"`
+	Reason    string `json:"reason,omitempty"` // Why a dependency was skipped
+}
+
+// Report collects the results of a run.
+type Report struct {
+	Results []*Result `json:"results"`
+}
+
+// Add appends a result, deriving its action when the caller did not set one.
+func (r *Report) Add(result Result) {
+	if result.Action == "" {
+		switch {
+		case result.Error != "":
+			result.Action = ActionError
+		case result.Proposed != "" && result.Proposed != result.Current:
+			result.Action = ActionOutdated
+		default:
+			result.Action = ActionUpToDate
+		}
+	}
+
+	r.Results = append(r.Results, &result)
+}
+
+// Outdated reports whether a file has at least one outdated dependency.
+func (r *Report) Outdated(file string) bool {
+	for _, result := range r.Results {
+		if result.File == file && result.Action == ActionOutdated {
+			return true
+		}
+	}
+	return false
+}
+
+// MarkUpdated flags every outdated result of a file as updated once it was written.
+func (r *Report) MarkUpdated(file string) {
+	for _, result := range r.Results {
+		if result.File == file && result.Action == ActionOutdated {
+			result.Action = ActionUpdated
+		}
+	}
+}
+
+// SortByFile groups the results by file, following the given file order. Results of
+// the same file keep their relative order.
+func (r *Report) SortByFile(files []string) {
+	position := make(map[string]int, len(files))
+	for i, file := range files {
+		position[file] = i
+	}
+	sort.SliceStable(r.Results, func(i, j int) bool {
+		return position[r.Results[i].File] < position[r.Results[j].File]
+	})
+}
+
+// WriteJSON writes the report as an indented JSON document.
+func (r *Report) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.SetEscapeHTML(false)
+	return encoder.Encode(r)
+}
+
+// WriteText writes the report as an aligned table, one dependency per line.
+func (r *Report) WriteText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "FILE\tTYPE\tNAME\tCURRENT\tLATEST\tPROPOSED\tACTION")
+	for _, result := range r.Results {
+		action := string(result.Action)
+		if result.Error != "" {
+			action += ": " + result.Error
+		} else if result.Reason != "" {
+			action += ": " + result.Reason
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			result.File, dash(result.BlockType), dash(result.BlockName),
+			dash(result.Current), dash(result.Latest), dash(result.Proposed), action)
+	}
+	return tw.Flush()
+}
+
+// dash replaces empty table cells with a dash.
+func dash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,219 @@
+package resolver
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+
+	"tfau/lib/index"
+	"tfau/lib/module"
+	"tfau/lib/provider"
+	"tfau/lib/semver"
+	"tfau/lib/terraform"
+
+	"github.com/hashicorp/go-version"
+)
+
+// Kind is the kind of dependency a version list belongs to.
+type Kind string
+
+const (
+	KindModule    Kind = "module"
+	KindProvider  Kind = "provider"
+	KindTerraform Kind = "terraform"
+)
+
+// TerraformAddress is the address used for the Terraform version itself.
+const TerraformAddress = "terraform"
+
+// Key identifies a dependency independently of the files that use it.
+type Key struct {
+	Kind    Kind
+	Address string // Module source, provider source or TerraformAddress
+}
+
+// entry holds the resolved version list of a key.
+type entry struct {
+	versions []*version.Version
+	err      error
+}
+
+// Resolver collects every unique dependency across all files, fetches their available
+// versions concurrently, and shares each answer with every file that uses it.
+type Resolver struct {
+	Index   *index.Index // Optional snapshot consulted before any lookup
+	Offline bool         // Only resolve from the index or the HTTP cache
+
+	workers int
+	mu      sync.Mutex
+	entries map[Key]*entry
+	pending []Key
+}
+
+// New creates a resolver that performs at most workers lookups at a time.
+func New(workers int) *Resolver {
+	if workers < 1 {
+		workers = 1
+	}
+	return &Resolver{
+		workers: workers,
+		entries: make(map[Key]*entry),
+	}
+}
+
+// Add registers a dependency to resolve. Adding the same key twice is a no-op.
+func (r *Resolver) Add(key Key) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.entries[key]; exists {
+		return
+	}
+	r.entries[key] = nil
+	r.pending = append(r.pending, key)
+}
+
+// Resolve fetches the versions of every pending dependency with a bounded worker pool.
+func (r *Resolver) Resolve() {
+	r.mu.Lock()
+	pending := r.pending
+	r.pending = nil
+	r.mu.Unlock()
+
+	log.Printf("Resolving %d unique dependencies with %d workers", len(pending), r.workers)
+
+	keys := make(chan Key)
+	var wg sync.WaitGroup
+	for i := 0; i < r.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for key := range keys {
+				versions, err := r.list(key)
+				r.mu.Lock()
+				r.entries[key] = &entry{versions: versions, err: err}
+				r.mu.Unlock()
+			}
+		}()
+	}
+
+	for _, key := range pending {
+		keys <- key
+	}
+	close(keys)
+	wg.Wait()
+}
+
+// Versions returns the available versions of a resolved dependency.
+func (r *Resolver) Versions(key Key) ([]*version.Version, error) {
+	r.mu.Lock()
+	e := r.entries[key]
+	r.mu.Unlock()
+
+	if e == nil {
+		return nil, fmt.Errorf("%s '%s' was not resolved", key.Kind, key.Address)
+	}
+	return e.versions, e.err
+}
+
+// Latest returns the newest version of a dependency that its policy allows relative
+// to the current version or constraint of one of its users. The version is returned
+// as published, so Git modules get their exact tag name (e.g. v1.5.0).
+func (r *Resolver) Latest(key Key, current string, policy semver.Policy) (string, error) {
+	versions, err := r.Versions(key)
+	if err != nil {
+		return "", err
+	}
+
+	latestVersion, err := semver.Latest(versions, current, policy)
+	if err != nil {
+		return "", fmt.Errorf("failed to select version for %s '%s': %v", key.Kind, key.Address, err)
+	}
+	return latestVersion.Original(), nil
+}
+
+// Keys returns every dependency registered so far, sorted by kind and address.
+func (r *Resolver) Keys() []Key {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	keys := make([]Key, 0, len(r.entries))
+	for key := range r.entries {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Kind != keys[j].Kind {
+			return keys[i].Kind < keys[j].Kind
+		}
+		return keys[i].Address < keys[j].Address
+	})
+	return keys
+}
+
+// list fetches the available versions of a dependency from the index, or from its
+// origin unless offline.
+func (r *Resolver) list(key Key) ([]*version.Version, error) {
+	if versions, ok := r.fromIndex(key); ok {
+		log.Printf("Using index versions for %s '%s'", key.Kind, key.Address)
+		return index.Parse(versions)
+	}
+
+	// Offline, only registry lookups can be served (from the HTTP cache)
+	if r.Offline && key.Kind == KindModule && !module.UsesRegistry(key.Address) {
+		return nil, fmt.Errorf("%s '%s' is not in the index (offline mode)", key.Kind, key.Address)
+	}
+
+	switch key.Kind {
+	case KindModule:
+		return module.ListModuleVersions(key.Address)
+	case KindProvider:
+		return provider.ListVersions(key.Address)
+	case KindTerraform:
+		return terraform.ListVersions()
+	}
+	return nil, fmt.Errorf("unknown dependency kind: %s", key.Kind)
+}
+
+// fromIndex looks a dependency up in the index.
+func (r *Resolver) fromIndex(key Key) ([]string, bool) {
+	if r.Index == nil {
+		return nil, false
+	}
+
+	var versions []string
+	switch key.Kind {
+	case KindModule:
+		versions = r.Index.Modules[key.Address]
+	case KindProvider:
+		versions = r.Index.Providers[key.Address]
+	case KindTerraform:
+		versions = r.Index.Terraform
+	}
+	return versions, len(versions) > 0
+}
+
+// Export builds an index from every resolved dependency.
+func (r *Resolver) Export() (*index.Index, error) {
+	idx := index.New()
+	for _, key := range r.Keys() {
+		versions, err := r.Versions(key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve %s '%s': %v", key.Kind, key.Address, err)
+		}
+		switch key.Kind {
+		case KindModule:
+			idx.Modules[key.Address] = index.Strings(versions)
+
+			// Modules pinned to a commit are compared by the tags of the commit
+			if commits := module.TagCommits(key.Address); commits != nil {
+				address, _, _ := strings.Cut(key.Address, "#")
+				idx.Commits[address] = commits
+			}
+		case KindProvider:
+			idx.Providers[key.Address] = index.Strings(versions)
+		case KindTerraform:
+			idx.Terraform = index.Strings(versions)
+		}
+	}
+	return idx, nil
+}
@@ -0,0 +1,131 @@
+package semver
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"tfau/lib/constraint"
+
+	"github.com/hashicorp/go-version"
+)
+
+// Bump is the largest kind of upgrade allowed relative to the current version.
+type Bump int
+
+const (
+	// Major allows any newer version (the default)
+	Major Bump = iota
+	// Minor keeps the major version of the current version
+	Minor
+	// Patch keeps the major and minor versions of the current version
+	Patch
+)
+
+// String returns the flag value of the bump.
+func (b Bump) String() string {
+	switch b {
+	case Minor:
+		return "minor"
+	case Patch:
+		return "patch"
+	}
+	return "major"
+}
+
+// ParseBump parses a --max-bump value (patch, minor or major).
+func ParseBump(s string) (Bump, error) {
+	switch strings.ToLower(s) {
+	case "", "major":
+		return Major, nil
+	case "minor":
+		return Minor, nil
+	case "patch":
+		return Patch, nil
+	}
+	return Major, fmt.Errorf("unknown bump '%s' (expected patch, minor or major)", s)
+}
+
+// Policy controls which versions a resolver may pick.
+type Policy struct {
+	MaxBump         Bump
+	AllowPrerelease bool             // Allow prereleases for every dependency
+	PrereleaseFor   []string         // Dependencies (source addresses) allowed to pick prereleases
+	Below           *version.Version // Versions at or above are never picked
+}
+
+// For returns the policy that applies to a single dependency.
+func (p Policy) For(address string) Policy {
+	for _, allowed := range p.PrereleaseFor {
+		if strings.EqualFold(allowed, address) {
+			p.AllowPrerelease = true
+		}
+	}
+	return p
+}
+
+// Allows reports whether candidate is within the allowed bump from baseline, below the
+// ceiling of the policy, and satisfies the prerelease policy.
+func (p Policy) Allows(baseline *version.Version, candidate *version.Version) bool {
+	// Prereleases are excluded unless allowed, or unless the current version is
+	// itself a prerelease of the same release (e.g. an alpha moving to an RC or GA)
+	if candidate.Prerelease() != "" && !p.AllowPrerelease {
+		if baseline == nil || baseline.Prerelease() == "" || !baseline.Core().Equal(candidate.Core()) {
+			return false
+		}
+	}
+
+	// Held dependencies stay below their ceiling, prereleases of the ceiling included
+	if p.Below != nil && !candidate.Core().LessThan(p.Below) {
+		return false
+	}
+
+	if baseline == nil {
+		return true
+	}
+	current, next := baseline.Segments(), candidate.Segments()
+	switch p.MaxBump {
+	case Minor:
+		return next[0] == current[0]
+	case Patch:
+		return next[0] == current[0] && next[1] == current[1]
+	}
+	return true
+}
+
+// Latest returns the newest version allowed by the policy relative to the current
+// version or constraint. An empty or unparseable current value has no ceiling, which is
+// an error unless any bump is allowed.
+func Latest(versions []*version.Version, current string, policy Policy) (*version.Version, error) {
+	// A bump ceiling needs a current version; without one, any upgrade could be major
+	var baseline *version.Version
+	if current != "" {
+		var err error
+		baseline, err = constraint.Baseline(current)
+		if err != nil && policy.MaxBump != Major {
+			return nil, fmt.Errorf("cannot apply a %s bump ceiling to '%s': %v", policy.MaxBump, current, err)
+		}
+	} else if policy.MaxBump != Major {
+		return nil, fmt.Errorf("cannot apply a %s bump ceiling without a current version", policy.MaxBump)
+	}
+
+	// Sort versions in descending order
+	sorted := make([]*version.Version, len(versions))
+	copy(sorted, versions)
+	sort.Sort(sort.Reverse(version.Collection(sorted)))
+
+	// The latest version is the first allowed item in the sorted list
+	for _, v := range sorted {
+		if policy.Allows(baseline, v) {
+			return v, nil
+		}
+	}
+
+	if baseline != nil && policy.MaxBump != Major {
+		return nil, fmt.Errorf("no release within a %s bump of %s", policy.MaxBump, baseline)
+	}
+	if policy.Below != nil {
+		return nil, fmt.Errorf("no release below %s", policy.Below)
+	}
+	return nil, fmt.Errorf("no releases available")
+}
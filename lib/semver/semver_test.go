@@ -0,0 +1,80 @@
+package semver
+
+import (
+	"testing"
+
+	"github.com/hashicorp/go-version"
+)
+
+// versions parses a list of versions.
+func versions(t *testing.T, list ...string) []*version.Version {
+	t.Helper()
+	parsed := make([]*version.Version, 0, len(list))
+	for _, v := range list {
+		parsed = append(parsed, version.Must(version.NewVersion(v)))
+	}
+	return parsed
+}
+
+func TestLatest(t *testing.T) {
+	available := versions(t, "5.0.0", "5.1.0", "5.1.3", "5.4.0", "6.0.0", "6.2.1", "7.0.0-beta1")
+	tests := []struct {
+		current string
+		policy  Policy
+		want    string
+	}{
+		{"~> 5.1", Policy{}, "6.2.1"},
+		{"", Policy{}, "6.2.1"},
+		{"main", Policy{}, "6.2.1"},
+		{"~> 5.1", Policy{MaxBump: Minor}, "5.4.0"},
+		{"~> 5.1", Policy{MaxBump: Patch}, "5.1.3"},
+		{">= 5.1, < 6.0", Policy{MaxBump: Patch}, "5.1.3"},
+		{"~> 5.1", Policy{AllowPrerelease: true}, "7.0.0-beta1"},
+		{"~> 5.1", Policy{PrereleaseFor: []string{"hashicorp/google"}}, "6.2.1"},
+	}
+	for _, test := range tests {
+		got, err := Latest(available, test.current, test.policy)
+		if err != nil {
+			t.Errorf("Latest(%q, %+v) returned an error: %v", test.current, test.policy, err)
+			continue
+		}
+		if got.String() != test.want {
+			t.Errorf("Latest(%q, %+v) = %s, want %s", test.current, test.policy, got, test.want)
+		}
+	}
+}
+
+func TestLatestWithoutBaseline(t *testing.T) {
+	available := versions(t, "5.0.0", "6.0.0", "7.0.0")
+
+	// A bump ceiling is never dropped for a constraint or ref without a lower bound
+	for _, current := range []string{"< 6.0", "main", ""} {
+		for _, bump := range []Bump{Minor, Patch} {
+			if got, err := Latest(available, current, Policy{MaxBump: bump}); err == nil {
+				t.Errorf("Latest(%q, %s) = %s, want an error", current, bump, got)
+			}
+		}
+	}
+}
+
+func TestLatestPrereleaseBaseline(t *testing.T) {
+	// A prerelease moves to the next prerelease or the release of the same version
+	available := versions(t, "1.9.0", "1.10.0-alpha1", "1.10.0-rc1", "1.11.0-beta1")
+	got, err := Latest(available, "1.10.0-alpha1", Policy{})
+	if err != nil {
+		t.Fatalf("Latest returned an error: %v", err)
+	}
+	if got.String() != "1.10.0-rc1" {
+		t.Errorf("Latest = %s, want 1.10.0-rc1", got)
+	}
+}
+
+func TestPolicyFor(t *testing.T) {
+	policy := Policy{MaxBump: Minor, PrereleaseFor: []string{"hashicorp/google-beta"}}
+	if got := policy.For("HashiCorp/Google-Beta"); !got.AllowPrerelease || got.MaxBump != Minor {
+		t.Errorf("For(hashicorp/google-beta) = %+v, want prereleases within a minor bump", got)
+	}
+	if got := policy.For("hashicorp/google"); got.AllowPrerelease {
+		t.Errorf("For(hashicorp/google) = %+v, want no prereleases", got)
+	}
+}
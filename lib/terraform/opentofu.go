@@ -0,0 +1,68 @@
+package terraform
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+
+	"tfau/lib/httpcache"
+
+	"github.com/hashicorp/go-version"
+)
+
+// openTofuReleasesURL is the GitHub releases API of the OpenTofu repository.
+const openTofuReleasesURL = "https://api.github.com/repos/opentofu/opentofu/releases"
+
+// releasesPerPage is the largest page size supported by the GitHub API.
+const releasesPerPage = 100
+
+// GitHubRelease represents a release returned by the GitHub releases API.
+type GitHubRelease struct {
+	TagName string `json:"tag_name"`
+	Draft   bool   `json:"draft"`
+}
+
+// listOpenTofuVersions fetches all OpenTofu versions from its GitHub releases.
+func listOpenTofuVersions() ([]*version.Version, error) {
+	var versionList []*version.Version
+	for page := 1; ; page++ {
+		// Construct the URL of the releases page
+		url := fmt.Sprintf("%s?per_page=%d&page=%d", openTofuReleasesURL, releasesPerPage, page)
+		log.Printf("Fetching OpenTofu versions (URL: %s)", url) // Debug log
+
+		body, err := httpcache.Get(url)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch OpenTofu versions: %v", err)
+		}
+
+		var releases []GitHubRelease
+		if err := json.Unmarshal(body, &releases); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal response: %v", err)
+		}
+
+		// Parse versions, drafts are not published
+		for _, release := range releases {
+			if release.Draft {
+				continue
+			}
+			parsedVersion, err := version.NewVersion(strings.TrimPrefix(release.TagName, "v"))
+			if err != nil {
+				log.Printf("Failed to parse version '%s': %v", release.TagName, err)
+				continue
+			}
+			versionList = append(versionList, parsedVersion)
+		}
+
+		// A partial page is the last one
+		if len(releases) < releasesPerPage {
+			break
+		}
+	}
+
+	if len(versionList) == 0 {
+		return nil, fmt.Errorf("no valid OpenTofu versions found")
+	}
+
+	return versionList, nil
+}
@@ -3,10 +3,9 @@ package terraform
 import (
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"log"
-	"net/http"
-	"sort"
+
+	"tfau/lib/httpcache"
 
 	"github.com/hashicorp/go-version"
 	"github.com/hashicorp/hcl/v2"
@@ -14,6 +13,17 @@ import (
 	"github.com/zclconf/go-cty/cty"
 )
 
+// Distribution is the Terraform distribution whose versions are looked up.
+type Distribution string
+
+const (
+	DistributionTerraform Distribution = "terraform" // HashiCorp Terraform
+	DistributionOpenTofu  Distribution = "opentofu"  // OpenTofu
+)
+
+// Target is the distribution used by ListVersions, configured by the CLI.
+var Target = DistributionTerraform
+
 // TerraformReleases represents the response from the Terraform Releases API.
 type TerraformReleases struct {
 	Versions map[string]struct {
@@ -64,37 +74,36 @@ func Extract(content *hcl.BodyContent) (string, error) {
 	return "", nil
 }
 
-// GetLatestVersion fetches the latest Terraform version from the Terraform Releases API.
-func GetLatestVersion() (string, error) {
-	// Construct the URL for the Terraform Releases API
-	url := "https://releases.hashicorp.com/terraform/index.json"
-	log.Printf("Fetching latest Terraform version (URL: %s)", url) // Debug log
-
-	resp, err := http.Get(url)
-	if err != nil {
-		return "", fmt.Errorf("failed to fetch Terraform versions: %v", err)
+// ListVersions fetches all versions of the target distribution: from the Terraform
+// Releases API, or from the OpenTofu GitHub releases.
+func ListVersions() ([]*version.Version, error) {
+	if Target == DistributionOpenTofu {
+		return listOpenTofuVersions()
 	}
-	defer resp.Body.Close()
+	return listTerraformVersions()
+}
 
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("failed to fetch Terraform versions: %s", resp.Status)
-	}
+// listTerraformVersions fetches all Terraform versions from the Terraform Releases API.
+func listTerraformVersions() ([]*version.Version, error) {
+	// Construct the URL for the Terraform Releases API
+	url := "https://releases.hashicorp.com/terraform/index.json"
+	log.Printf("Fetching Terraform versions (URL: %s)", url) // Debug log
 
-	body, err := ioutil.ReadAll(resp.Body)
+	body, err := httpcache.Get(url)
 	if err != nil {
-		return "", fmt.Errorf("failed to read response body: %v", err)
+		return nil, fmt.Errorf("failed to fetch Terraform versions: %v", err)
 	}
 
 	var releases TerraformReleases
 	if err := json.Unmarshal(body, &releases); err != nil {
-		return "", fmt.Errorf("failed to unmarshal response: %v", err)
+		return nil, fmt.Errorf("failed to unmarshal response: %v", err)
 	}
 
 	if len(releases.Versions) == 0 {
-		return "", fmt.Errorf("no Terraform versions found")
+		return nil, fmt.Errorf("no Terraform versions found")
 	}
 
-	// Parse versions and sort them
+	// Parse versions
 	var versionList []*version.Version
 	for versionStr := range releases.Versions {
 		parsedVersion, err := version.NewVersion(versionStr)
@@ -106,66 +115,23 @@ func GetLatestVersion() (string, error) {
 	}
 
 	if len(versionList) == 0 {
-		return "", fmt.Errorf("no valid Terraform versions found")
-	}
-
-	// Sort versions in descending order
-	sort.Sort(sort.Reverse(version.Collection(versionList)))
-
-	// The latest version is the first item in the sorted list
-	latestVersion := versionList[0].String()
-	return latestVersion, nil
-}
-
-// ExtractWithLatestVersion extracts the current Terraform version and fetches the latest version.
-func ExtractWithLatestVersion(content *hcl.BodyContent) (string, string, error) {
-	// Extract current version
-	currentVersion, err := Extract(content)
-	if err != nil {
-		return "", "", fmt.Errorf("failed to extract Terraform version: %v", err)
-	}
-
-	log.Printf("Extracted Terraform version: %s", currentVersion) // Debug log
-
-	// Fetch the latest version
-	latestVersion, err := GetLatestVersion()
-	if err != nil {
-		return "", "", fmt.Errorf("failed to get latest Terraform version: %v", err)
+		return nil, fmt.Errorf("no valid Terraform versions found")
 	}
 
-	log.Printf("Latest Terraform version: %s", latestVersion) // Debug log
-
-	return currentVersion, latestVersion, nil
+	return versionList, nil
 }
 
-// UpdateRequiredVersion updates the required_version in the HCL content and writes it back to the file.
-func UpdateRequiredVersion(filename string, newVersion string) error {
-	// Read the file content
-	src, err := ioutil.ReadFile(filename)
-	if err != nil {
-		return fmt.Errorf("failed to read file: %v", err)
-	}
-
-	// Parse the HCL content
-	file, diags := hclwrite.ParseConfig(src, filename, hcl.Pos{Line: 1, Column: 1})
-	if diags.HasErrors() {
-		return fmt.Errorf("failed to parse HCL content: %s", diags)
-	}
-
+// UpdateRequiredVersion updates the required_version in the in-memory HCL document. It
+// reports whether the document has a terraform block to update.
+func UpdateRequiredVersion(file *hclwrite.File, newVersion string) bool {
 	// Find the terraform block
 	body := file.Body()
 	for _, block := range body.Blocks() {
 		if block.Type() == "terraform" {
 			// Update the required_version attribute
 			block.Body().SetAttributeValue("required_version", cty.StringVal(newVersion))
-			break
+			return true
 		}
 	}
-
-	// Write the updated content back to the file
-	if err := ioutil.WriteFile(filename, file.Bytes(), 0644); err != nil {
-		return fmt.Errorf("failed to write file: %v", err)
-	}
-
-	return nil
+	return false
 }
@@ -1,12 +1,20 @@
 package main
 
 import (
+	"errors"
 	"log"
+	"os"
 	"tfau/cmd"
 )
 
 func main() {
 	if err := cmd.Execute(); err != nil {
+		// Exit with the code requested by the command, if any
+		var exitErr *cmd.ExitError
+		if errors.As(err, &exitErr) {
+			log.Printf("Error: %v", err)
+			os.Exit(exitErr.Code)
+		}
 		log.Fatalf("Error: %v", err)
 	}
 }